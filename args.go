@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// protocFlagsWithoutValue are the protoc flags that never take a value. All
+// the other flags require one, either after "=" or as the next argument.
+var protocFlagsWithoutValue = map[string]bool{
+	"-h": true, "--help": true, "--version": true,
+	"--decode_raw": true, "--deterministic_output": true,
+	"--disallow_services": true, "--experimental_allow_proto3_optional": true,
+	"--experimental_editions": true, "--fatal_warnings": true,
+	"--include_imports": true, "--include_source_info": true,
+	"--print_free_field_numbers": true, "--retain_options": true,
+	"--enable_codegen_trace": true, "--notices": true, "--": true,
+	// Wrapper-specific flags
+	"--check": true, "--force": true, "--resolve-only": true,
+}
+
+// protocArg is a single parsed protoc argument: a flag with an optional value,
+// or an input file if the flag is empty.
+type protocArg struct {
+	flag  string
+	value string
+}
+
+func (a protocArg) String() string {
+	switch {
+	case a.flag == "":
+		return a.value
+	case protocFlagsWithoutValue[a.flag]:
+		return a.flag
+	}
+	return a.flag + "=" + a.value
+}
+
+// parseProtocArgs parses the arguments using the protoc flag grammar:
+// "--name=value", "--name value", "-Xvalue" and "-X value" flags, "@file"
+// response files with one argument per line, and "--" separating the input
+// files. The short "-o" flag is normalized to "--descriptor_set_out" and the
+// "--proto_path" flag to "-I". Values of "-I" flags are stored without the
+// leading "=".
+func parseProtocArgs(in []string) ([]protocArg, error) {
+	expanded := []string{}
+	for _, arg := range in {
+		if strings.HasPrefix(arg, "@") {
+			lines, err := readResponseFile(strings.TrimPrefix(arg, "@"))
+			if err != nil {
+				return nil, err
+			}
+			expanded = append(expanded, lines...)
+		} else {
+			expanded = append(expanded, arg)
+		}
+	}
+	args := []protocArg{}
+	for i := 0; i < len(expanded); i++ {
+		arg := expanded[i]
+		if arg == "--" {
+			args = append(args, protocArg{flag: arg})
+			for _, file := range expanded[i+1:] {
+				args = append(args, protocArg{value: file})
+			}
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			args = append(args, protocArg{value: arg})
+			continue
+		}
+		var a protocArg
+		hasValue := false
+		if strings.HasPrefix(arg, "--") {
+			a.flag = arg
+			if eq := strings.Index(arg, "="); eq >= 0 {
+				a.flag, a.value, hasValue = arg[:eq], arg[eq+1:], true
+			}
+		} else {
+			a.flag, a.value, hasValue = arg[:2], arg[2:], len(arg) > 2
+		}
+		if protocFlagsWithoutValue[a.flag] {
+			if hasValue {
+				return nil, fmt.Errorf("%s does not take a value", a.flag)
+			}
+		} else if !hasValue {
+			if i+1 >= len(expanded) {
+				return nil, fmt.Errorf("missing value for flag: %s", a.flag)
+			}
+			i++
+			a.value = expanded[i]
+		}
+		switch a.flag {
+		case "-o":
+			a.flag = "--descriptor_set_out"
+		case "--proto_path":
+			a.flag = "-I"
+		}
+		if a.flag == "-I" {
+			a.value = strings.TrimPrefix(a.value, "=")
+		}
+		args = append(args, a)
+	}
+	return args, nil
+}
+
+// readResponseFile reads the arguments from the local or remote response
+// file, one per line. Empty lines are ignored.
+func readResponseFile(name string) ([]string, error) {
+	name, _, err := resolvePath(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// appendFiles appends the input files to the protoc arguments, after the "--"
+// separator if any of them could be taken for a flag.
+func appendFiles(args []string, files ...string) []string {
+	out := append([]string{}, args...)
+	for _, f := range files {
+		if strings.HasPrefix(f, "-") {
+			out = append(out, "--")
+			break
+		}
+	}
+	return append(out, files...)
+}
+
+// hasProtocFlag returns true if the arguments contain one of the flags.
+func hasProtocFlag(args []protocArg, flags ...string) bool {
+	for _, a := range args {
+		for _, flag := range flags {
+			if a.flag == flag {
+				return true
+			}
+		}
+	}
+	return false
+}
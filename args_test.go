@@ -0,0 +1,135 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProtocArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	argsFile := filepath.Join(dir, "args.txt")
+	ioutil.WriteFile(argsFile, []byte("--go_out=gen\r\n\n-I\nproto\ngithub.com/org/repo/foo.proto\n"), 0644)
+
+	for _, test := range []struct {
+		name string
+		in   []string
+		out  []string
+		err  bool
+	}{
+		{name: "input files", in: []string{"foo.proto", "-"}, out: []string{"foo.proto", "-"}},
+		{name: "long flag with value", in: []string{"--go_out=paths=source_relative:gen"}, out: []string{"--go_out=paths=source_relative:gen"}},
+		{name: "long flag with separate value", in: []string{"--go_out", "gen", "foo.proto"}, out: []string{"--go_out=gen", "foo.proto"}},
+		{name: "proto_path", in: []string{"--proto_path=a", "--proto_path", "b"}, out: []string{"-I=a", "-I=b"}},
+		{name: "short include", in: []string{"-Ia", "-I=b", "-I", "c"}, out: []string{"-I=a", "-I=b", "-I=c"}},
+		{name: "short output", in: []string{"-oout.pb", "-o", "out.pb"}, out: []string{"--descriptor_set_out=out.pb", "--descriptor_set_out=out.pb"}},
+		{name: "descriptor_set_in", in: []string{"--descriptor_set_in", "a.pb:b.pb", "foo.proto"}, out: []string{"--descriptor_set_in=a.pb:b.pb", "foo.proto"}},
+		{name: "flags without value", in: []string{"--include_imports", "foo.proto", "--version", "-h"}, out: []string{"--include_imports", "foo.proto", "--version", "-h"}},
+		{name: "wrapper flags", in: []string{"--force", "--check", "--bundle", "googleapis"}, out: []string{"--force", "--check", "--bundle=googleapis"}},
+		{name: "separator", in: []string{"-I.", "--", "-foo.proto", "--bar.proto"}, out: []string{"-I=.", "--", "-foo.proto", "--bar.proto"}},
+		{name: "notices", in: []string{"--notices"}, out: []string{"--notices"}},
+		{name: "response file", in: []string{"@" + argsFile, "bar.proto"}, out: []string{"--go_out=gen", "-I=proto", "github.com/org/repo/foo.proto", "bar.proto"}},
+		{name: "missing response file", in: []string{"@" + filepath.Join(dir, "missing.txt")}, err: true},
+		{name: "missing value", in: []string{"foo.proto", "--go_out"}, err: true},
+		{name: "missing short value", in: []string{"-I"}, err: true},
+		{name: "unexpected value", in: []string{"--include_imports=true"}, err: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			args, err := parseProtocArgs(test.in)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			out := []string{}
+			for _, a := range args {
+				out = append(out, a.String())
+			}
+			assert.Equal(t, test.out, out)
+		})
+	}
+}
+
+func TestAppendFiles(t *testing.T) {
+	assert.Equal(t, []string{"-I=.", "foo.proto"}, appendFiles([]string{"-I=."}, "foo.proto"))
+	assert.Equal(t, []string{"-I=.", "--", "foo.proto", "-bar.proto"}, appendFiles([]string{"-I=."}, "foo.proto", "-bar.proto"))
+}
+
+func TestRemoteFlagPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(f func() string) { cacheDir = f }(cacheDir)
+	cacheDir = func() string { return filepath.Join(dir, "cache") }
+	defer func(c *config) { cfg = c }(cfg)
+	contracts := filepath.Join(dir, "contracts")
+	cfg = &config{Replace: map[string]string{"github.com/org/contracts": contracts}}
+
+	os.MkdirAll(filepath.Join(contracts, "bin"), 0755)
+	ioutil.WriteFile(filepath.Join(contracts, "set.pb"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(contracts, "bin", "gen.sh"), nil, 0755)
+	ioutil.WriteFile(filepath.Join(contracts, "protoc.args"), []byte("--foo_out=gen\n"), 0644)
+	local := filepath.Join(dir, "local.pb")
+	ioutil.WriteFile(local, nil, 0644)
+
+	out, _, err := processArgs([]string{
+		"--descriptor_set_in=github.com/org/contracts/set.pb@v1" + string(os.PathListSeparator) + local,
+		"--plugin=protoc-gen-foo=github.com/org/contracts/bin/gen.sh",
+		"@github.com/org/contracts/protoc.args",
+		"-I=third_party",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"--descriptor_set_in=" + filepath.Join(contracts, "set.pb") + string(os.PathListSeparator) + local,
+		"--plugin=protoc-gen-foo=" + filepath.Join(contracts, "bin", "gen.sh"),
+		"--foo_out=gen",
+		"-I=third_party",
+	}, out[:4])
+
+	assert.Equal(t, []string{"https://example.com/set.pb", "a.pb"}, splitPathList("https://example.com/set.pb"+string(os.PathListSeparator)+"a.pb"))
+}
+
+func TestRemotePlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	dir := t.TempDir()
+	defer func(f func() string) { cacheDir = f }(cacheDir)
+	cacheDir = func() string { return filepath.Join(dir, "cache") }
+	defer func(c *config) { cfg = c }(cfg)
+	cfg = &config{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("#!/bin/sh\necho remote plugin\n"))
+	}))
+	defer server.Close()
+
+	out, _, err := processArgs([]string{"--plugin=protoc-gen-echo=" + server.URL + "/bin/protoc-gen-echo"})
+	assert.NoError(t, err)
+	plugin := strings.TrimPrefix(out[0], "--plugin=protoc-gen-echo=")
+	output, err := exec.Command(plugin).Output()
+	assert.NoError(t, err)
+	assert.Equal(t, "remote plugin\n", string(output))
+
+	// Plugins of the replaced repositories are not modified
+	local := filepath.Join(dir, "tools", "protoc-gen-echo")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(local), 0755))
+	assert.NoError(t, os.WriteFile(local, []byte("#!/bin/sh\n"), 0644))
+	cfg.Replace = map[string]string{"example.com/org/tools": filepath.Join(dir, "tools")}
+	out, _, err = processArgs([]string{"--plugin=protoc-gen-echo=example.com/org/tools/protoc-gen-echo"})
+	assert.NoError(t, err)
+	assert.Equal(t, "--plugin=protoc-gen-echo="+local, out[0])
+	info, err := os.Stat(local)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/sixt/protoc/v3/resolver"
+)
+
+// versionChecks are the supported strictness levels of the protoc version
+// check: the same release (e.g. 22.2), the same major release (e.g. 22.x),
+// or any version with a warning.
+var versionChecks = []string{"exact", "major", "any"}
+
+// versionCheck returns the strictness level from PROTOC_VERSION_CHECK or the
+// config, "major" by default.
+func versionCheck() (string, error) {
+	check := cfg.ProtocVersionCheck
+	if s := os.Getenv("PROTOC_VERSION_CHECK"); s != "" {
+		check = s
+	}
+	if check == "" {
+		return "major", nil
+	}
+	for _, c := range versionChecks {
+		if c == check {
+			return check, nil
+		}
+	}
+	return "", fmt.Errorf("unknown protoc version check: %s, available: %s", check, strings.Join(versionChecks, ", "))
+}
+
+// protocRelease returns the release number of the protoc version. Older
+// versions are numbered "3.21.12" and newer "22.2", both the wrapper version
+// "3.22.2" and "libprotoc 22.2" refer to the release "22.2".
+func protocRelease(v string) string {
+	v = strings.SplitN(v, "-", 2)[0]
+	if parts := strings.Split(v, "."); len(parts) == 3 && (parts[0] == "3" || parts[0] == "4") {
+		return parts[1] + "." + parts[2]
+	}
+	return v
+}
+
+// protocVersion runs the binary and returns its version.
+func protocVersion(exe string) (string, error) {
+	out, err := exec.CommandContext(runCtx, exe, "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("%s --version: %w", exe, err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("%s --version: no version", exe)
+	}
+	return fields[len(fields)-1], nil
+}
+
+// checkProtocVersion compares the version of the protoc binary with the
+// version of the wrapper using the configured strictness.
+func checkProtocVersion(exe string) error {
+	check, err := versionCheck()
+	if err != nil {
+		return &usageError{err}
+	}
+	v, err := protocVersion(exe)
+	if err != nil {
+		return err
+	}
+	have, want := protocRelease(v), protocRelease(version)
+	if have == want {
+		return nil
+	}
+	major := func(release string) string { return strings.SplitN(release, ".", 2)[0] }
+	switch {
+	case check == "any", check == "major" && major(have) == major(want):
+		logWarn("Using protoc", v, "from", exe, "instead of", version)
+		return nil
+	}
+	return fmt.Errorf("protoc %s from %s does not match the required version %s (%s version check)", v, exe, version, check)
+}
+
+// systemProtoc returns the protoc binary found on PATH, skipping the wrapper
+// itself, or an empty string if there is none.
+func systemProtoc() string {
+	self, _ := os.Executable()
+	selfInfo, _ := os.Stat(self)
+	name := "protoc"
+	if runtime.GOOS == "windows" {
+		name = "protoc.exe"
+	}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		exe := filepath.Join(dir, name)
+		info, err := os.Stat(exe)
+		if err != nil || info.IsDir() || (selfInfo != nil && os.SameFile(info, selfInfo)) {
+			continue
+		}
+		if runtime.GOOS != "windows" && info.Mode()&0111 == 0 {
+			continue
+		}
+		return exe
+	}
+	return ""
+}
+
+// protocPlatform is the GOOS_GOARCH platform of the protoc binary.
+var protocPlatform = runtime.GOOS + "_" + runtime.GOARCH
+
+// hasProtocDownload tells whether protoc binaries are published for the
+// platform.
+func hasProtocDownload(platform string) bool {
+	for _, p := range resolver.Platforms() {
+		if p == platform {
+			return true
+		}
+	}
+	return false
+}
+
+// protocPath returns the protoc binary that a regular run would use, without
+// downloading it.
+func protocPath() string {
+	if exe := os.Getenv("PROTOC_BIN"); exe != "" {
+		return exe
+	}
+	if !hasProtocDownload(protocPlatform) {
+		if sys := systemProtoc(); sys != "" {
+			return sys
+		}
+	}
+	return newResolver().ProtocPath(version, protocPlatform)
+}
+
+// downloadProtoc returns the protoc binary: the one from PROTOC_BIN if set,
+// otherwise the binary downloaded for the current platform, or protoc found
+// on PATH if there is no download for the platform. Returns absolute path to
+// the protoc binary, or an error.
+func downloadProtoc() (string, error) {
+	if exe := os.Getenv("PROTOC_BIN"); exe != "" {
+		if err := checkProtocVersion(exe); err != nil {
+			return "", err
+		}
+		logDebug("Using protoc from PROTOC_BIN:", exe)
+		return exe, nil
+	}
+	if hasProtocDownload(protocPlatform) {
+		exe, err := newResolver().DownloadProtocFor(runCtx, version, protocPlatform)
+		if err != nil {
+			return "", fmt.Errorf("download protoc: %w", err)
+		}
+		return exe, nil
+	}
+	sys := systemProtoc()
+	if sys == "" {
+		return "", fmt.Errorf("no protoc download for %s and no protoc found on PATH, set PROTOC_BIN", protocPlatform)
+	}
+	logWarn("No protoc download for", protocPlatform+", using", sys)
+	if err := checkProtocVersion(sys); err != nil {
+		return "", err
+	}
+	return sys, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtocRelease(t *testing.T) {
+	for v, release := range map[string]string{
+		"3.22.2":   "22.2",
+		"22.2":     "22.2",
+		"3.21.12":  "21.12",
+		"4.26.0":   "26.0",
+		"25.0-rc1": "25.0",
+	} {
+		assert.Equal(t, release, protocRelease(v), v)
+	}
+}
+
+// fakeProtoc writes a script printing the protoc version into the directory.
+func fakeProtoc(t *testing.T, dir, v string) string {
+	exe := filepath.Join(dir, "protoc")
+	assert.NoError(t, os.WriteFile(exe, []byte("#!/bin/sh\necho libprotoc "+v+"\n"), 0755))
+	return exe
+}
+
+func TestSystemProtoc(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	defer func(c *config) { cfg = c }(cfg)
+	cfg = &config{}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	defer os.Unsetenv("PROTOC_BIN")
+	defer os.Unsetenv("PROTOC_VERSION_CHECK")
+
+	dir := t.TempDir()
+	os.Setenv("PATH", filepath.Join(dir, "missing")+string(os.PathListSeparator)+dir)
+	assert.Equal(t, "", systemProtoc())
+	exe := fakeProtoc(t, dir, "22.5")
+	assert.Equal(t, exe, systemProtoc())
+
+	assert.NoError(t, checkProtocVersion(exe))
+	cfg.ProtocVersionCheck = "exact"
+	assert.Error(t, checkProtocVersion(exe))
+	os.Setenv("PROTOC_VERSION_CHECK", "strict")
+	assert.Error(t, checkProtocVersion(exe))
+	os.Unsetenv("PROTOC_VERSION_CHECK")
+
+	cfg.ProtocVersionCheck = ""
+	old := fakeProtoc(t, t.TempDir(), "3.21.12")
+	os.Setenv("PROTOC_BIN", old)
+	_, err := downloadProtoc()
+	assert.Error(t, err)
+	os.Setenv("PROTOC_VERSION_CHECK", "any")
+	bin, err := downloadProtoc()
+	assert.NoError(t, err)
+	assert.Equal(t, old, bin)
+}
+
+func TestProtocFallback(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	defer func(c *config) { cfg = c }(cfg)
+	cfg = &config{}
+	defer func(p string) { protocPlatform = p }(protocPlatform)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	defer func(f func() string) { cacheDir = f }(cacheDir)
+	cache := t.TempDir()
+	cacheDir = func() string { return cache }
+
+	dir := t.TempDir()
+	exe := fakeProtoc(t, dir, protocRelease(version))
+	os.Setenv("PATH", dir)
+	assert.True(t, hasProtocDownload("linux_amd64"))
+	assert.False(t, hasProtocDownload("linux_riscv64"))
+
+	protocPlatform = "linux_riscv64"
+	assert.Equal(t, exe, protocPath())
+	bin, err := downloadProtoc()
+	assert.NoError(t, err)
+	assert.Equal(t, exe, bin)
+
+	os.Setenv("PATH", filepath.Join(dir, "missing"))
+	_, err = downloadProtoc()
+	assert.Error(t, err)
+}
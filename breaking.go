@@ -0,0 +1,306 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// breakingRule describes a single kind of incompatible change. Wire rules
+// detect changes that break serialized data or RPC calls, source rules detect
+// changes that break the code generated from the protos.
+type breakingRule struct {
+	id   string
+	wire bool
+	desc string
+}
+
+var breakingRules = []breakingRule{
+	{id: "FILE_REMOVED", desc: "file was removed"},
+	{id: "PACKAGE_CHANGED", wire: true, desc: "package was changed"},
+	{id: "MESSAGE_REMOVED", desc: "message was removed"},
+	{id: "FIELD_REMOVED", desc: "field was removed"},
+	{id: "FIELD_NUMBER_CHANGED", wire: true, desc: "field number was changed"},
+	{id: "FIELD_NAME_CHANGED", desc: "field name was changed"},
+	{id: "FIELD_TYPE_CHANGED", wire: true, desc: "field type was changed"},
+	{id: "FIELD_LABEL_CHANGED", wire: true, desc: "field label was changed"},
+	{id: "ENUM_REMOVED", desc: "enum was removed"},
+	{id: "ENUM_VALUE_REMOVED", desc: "enum value was removed"},
+	{id: "ENUM_VALUE_NUMBER_CHANGED", wire: true, desc: "enum value number was changed"},
+	{id: "SERVICE_REMOVED", wire: true, desc: "service was removed"},
+	{id: "RPC_REMOVED", wire: true, desc: "RPC was removed"},
+	{id: "RPC_SIGNATURE_CHANGED", wire: true, desc: "RPC request, response or streaming was changed"},
+}
+
+// breakingConfig selects the rules used for breaking change detection.
+type breakingConfig struct {
+	// Use is the rule set: "wire" or "source" (default, includes wire rules).
+	Use string `json:"use,omitempty"`
+	// Except disables individual rules by their IDs.
+	Except []string `json:"except,omitempty"`
+}
+
+// enabled returns the IDs of the rules enabled by the config.
+func (c breakingConfig) enabled() (map[string]bool, error) {
+	if c.Use != "" && c.Use != "wire" && c.Use != "source" {
+		return nil, fmt.Errorf("unknown breaking rule set: %s", c.Use)
+	}
+	rules := map[string]bool{}
+	for _, r := range breakingRules {
+		rules[r.id] = r.wire || c.Use != "wire"
+	}
+	for _, id := range c.Except {
+		if _, ok := rules[id]; !ok {
+			return nil, fmt.Errorf("unknown breaking rule: %s", id)
+		}
+		rules[id] = false
+	}
+	return rules, nil
+}
+
+// breakingChange is a single incompatible change found between two revisions.
+type breakingChange struct {
+	file    string
+	element string
+	rule    string
+	detail  string
+}
+
+func (c breakingChange) String() string {
+	return fmt.Sprintf("%s: %s: %s: %s", c.file, c.element, c.rule, c.detail)
+}
+
+type breakingChecker struct {
+	rules   map[string]bool
+	changes []breakingChange
+	file    string
+}
+
+func (c *breakingChecker) report(rule, element, format string, args ...interface{}) {
+	if c.rules[rule] {
+		c.changes = append(c.changes, breakingChange{file: c.file, element: element, rule: rule, detail: fmt.Sprintf(format, args...)})
+	}
+}
+
+// findBreakingChanges compares two descriptor sets and returns the list of
+// incompatible changes enabled by the rules.
+func findBreakingChanges(from, to *descriptorpb.FileDescriptorSet, rules map[string]bool) []breakingChange {
+	c := &breakingChecker{rules: rules}
+	newFiles := map[string]*descriptorpb.FileDescriptorProto{}
+	newMessages := map[string]*descriptorpb.DescriptorProto{}
+	newEnums := map[string]*descriptorpb.EnumDescriptorProto{}
+	newServices := map[string]*descriptorpb.ServiceDescriptorProto{}
+	for _, f := range to.File {
+		newFiles[f.GetName()] = f
+		collectTypes(f.GetPackage(), f.MessageType, f.EnumType, newMessages, newEnums)
+		for _, s := range f.Service {
+			newServices[qualify(f.GetPackage(), s.GetName())] = s
+		}
+	}
+	for _, f := range from.File {
+		c.file = f.GetName()
+		nf, ok := newFiles[f.GetName()]
+		if !ok {
+			c.report("FILE_REMOVED", f.GetName(), "file %s was removed", f.GetName())
+		} else if nf.GetPackage() != f.GetPackage() {
+			c.report("PACKAGE_CHANGED", f.GetName(), "package changed from %q to %q", f.GetPackage(), nf.GetPackage())
+		}
+		messages := map[string]*descriptorpb.DescriptorProto{}
+		enums := map[string]*descriptorpb.EnumDescriptorProto{}
+		collectTypes(f.GetPackage(), f.MessageType, f.EnumType, messages, enums)
+		for _, name := range sortedKeys(messages) {
+			if nm, ok := newMessages[name]; !ok {
+				c.report("MESSAGE_REMOVED", name, "message %s was removed", name)
+			} else {
+				c.compareFields(name, messages[name], nm)
+			}
+		}
+		for _, name := range sortedKeys(enums) {
+			if ne, ok := newEnums[name]; !ok {
+				c.report("ENUM_REMOVED", name, "enum %s was removed", name)
+			} else {
+				c.compareEnumValues(name, enums[name], ne)
+			}
+		}
+		for _, s := range f.Service {
+			name := qualify(f.GetPackage(), s.GetName())
+			if ns, ok := newServices[name]; !ok {
+				c.report("SERVICE_REMOVED", name, "service %s was removed", name)
+			} else {
+				c.compareMethods(name, s, ns)
+			}
+		}
+	}
+	return c.changes
+}
+
+func (c *breakingChecker) compareFields(msg string, from, to *descriptorpb.DescriptorProto) {
+	byNumber := map[int32]*descriptorpb.FieldDescriptorProto{}
+	byName := map[string]*descriptorpb.FieldDescriptorProto{}
+	for _, f := range to.Field {
+		byNumber[f.GetNumber()] = f
+		byName[f.GetName()] = f
+	}
+	for _, f := range from.Field {
+		element := msg + "." + f.GetName()
+		nf, ok := byNumber[f.GetNumber()]
+		if !ok {
+			if renumbered, ok := byName[f.GetName()]; ok {
+				c.report("FIELD_NUMBER_CHANGED", element, "field number changed from %d to %d", f.GetNumber(), renumbered.GetNumber())
+			} else {
+				c.report("FIELD_REMOVED", element, "field %d was removed", f.GetNumber())
+			}
+			continue
+		}
+		if nf.GetName() != f.GetName() {
+			c.report("FIELD_NAME_CHANGED", element, "field %d name changed from %q to %q", f.GetNumber(), f.GetName(), nf.GetName())
+		}
+		if nf.GetType() != f.GetType() || nf.GetTypeName() != f.GetTypeName() {
+			c.report("FIELD_TYPE_CHANGED", element, "field %d type changed from %s to %s", f.GetNumber(), fieldType(f), fieldType(nf))
+		}
+		if (nf.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED) != (f.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED) {
+			c.report("FIELD_LABEL_CHANGED", element, "field %d label changed from %s to %s", f.GetNumber(), f.GetLabel(), nf.GetLabel())
+		}
+	}
+}
+
+func (c *breakingChecker) compareEnumValues(enum string, from, to *descriptorpb.EnumDescriptorProto) {
+	byName := map[string]*descriptorpb.EnumValueDescriptorProto{}
+	for _, v := range to.Value {
+		byName[v.GetName()] = v
+	}
+	for _, v := range from.Value {
+		element := enum + "." + v.GetName()
+		if nv, ok := byName[v.GetName()]; !ok {
+			c.report("ENUM_VALUE_REMOVED", element, "enum value %d was removed", v.GetNumber())
+		} else if nv.GetNumber() != v.GetNumber() {
+			c.report("ENUM_VALUE_NUMBER_CHANGED", element, "enum value number changed from %d to %d", v.GetNumber(), nv.GetNumber())
+		}
+	}
+}
+
+func (c *breakingChecker) compareMethods(svc string, from, to *descriptorpb.ServiceDescriptorProto) {
+	byName := map[string]*descriptorpb.MethodDescriptorProto{}
+	for _, m := range to.Method {
+		byName[m.GetName()] = m
+	}
+	for _, m := range from.Method {
+		element := svc + "." + m.GetName()
+		nm, ok := byName[m.GetName()]
+		if !ok {
+			c.report("RPC_REMOVED", element, "RPC %s was removed", m.GetName())
+		} else if nm.GetInputType() != m.GetInputType() || nm.GetOutputType() != m.GetOutputType() ||
+			nm.GetClientStreaming() != m.GetClientStreaming() || nm.GetServerStreaming() != m.GetServerStreaming() {
+			c.report("RPC_SIGNATURE_CHANGED", element, "RPC signature changed from %s to %s", methodSignature(m), methodSignature(nm))
+		}
+	}
+}
+
+func qualify(pkg, name string) string {
+	if pkg == "" {
+		return name
+	}
+	return pkg + "." + name
+}
+
+// collectTypes collects all messages and enums including the nested ones by
+// their fully qualified names.
+func collectTypes(prefix string, messages []*descriptorpb.DescriptorProto, enums []*descriptorpb.EnumDescriptorProto,
+	outMessages map[string]*descriptorpb.DescriptorProto, outEnums map[string]*descriptorpb.EnumDescriptorProto) {
+	for _, e := range enums {
+		outEnums[qualify(prefix, e.GetName())] = e
+	}
+	for _, m := range messages {
+		name := qualify(prefix, m.GetName())
+		outMessages[name] = m
+		collectTypes(name, m.NestedType, m.EnumType, outMessages, outEnums)
+	}
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func fieldType(f *descriptorpb.FieldDescriptorProto) string {
+	if f.GetTypeName() != "" {
+		return strings.TrimPrefix(f.GetTypeName(), ".")
+	}
+	return strings.ToLower(strings.TrimPrefix(f.GetType().String(), "TYPE_"))
+}
+
+func methodSignature(m *descriptorpb.MethodDescriptorProto) string {
+	stream := func(s bool) string {
+		if s {
+			return "stream "
+		}
+		return ""
+	}
+	return fmt.Sprintf("(%s%s) returns (%s%s)", stream(m.GetClientStreaming()), strings.TrimPrefix(m.GetInputType(), "."),
+		stream(m.GetServerStreaming()), strings.TrimPrefix(m.GetOutputType(), "."))
+}
+
+// runBreaking implements `protoc breaking [--use=wire|source] [--except=RULE,...] <old> [<new>]`.
+// Both references are compiled into descriptor sets and compared. If the new
+// reference is omitted, the current directory is used.
+func runBreaking(protocExePath string, args []string, w io.Writer) int {
+	fs := flag.NewFlagSet("breaking", flag.ContinueOnError)
+	bc := cfg.Breaking
+	use := fs.String("use", bc.Use, "rule set: wire or source")
+	except := fs.String("except", strings.Join(bc.Except, ","), "comma-separated list of disabled rules")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fmt.Fprintln(os.Stderr, "USAGE: protoc breaking [--use=wire|source] [--except=RULE,...] <old> [<new>]")
+		fmt.Fprintln(os.Stderr, "Rules:")
+		for _, r := range breakingRules {
+			category := "source"
+			if r.wire {
+				category = "wire"
+			}
+			fmt.Fprintf(os.Stderr, "  %-26s %-6s %s\n", r.id, category, r.desc)
+		}
+		return exitUsage
+	}
+	bc.Use = *use
+	bc.Except = nil
+	if *except != "" {
+		bc.Except = strings.Split(*except, ",")
+	}
+	rules, err := bc.enabled()
+	if err != nil {
+		logError(err)
+		return exitUsage
+	}
+	oldRef, newRef := fs.Arg(0), "."
+	if fs.NArg() == 2 {
+		newRef = fs.Arg(1)
+	}
+	from, err := compileDescriptors(protocExePath, []string{oldRef}, false)
+	if err != nil {
+		return fail(oldRef+":", err)
+	}
+	to, err := compileDescriptors(protocExePath, []string{newRef}, false)
+	if err != nil {
+		return fail(newRef+":", err)
+	}
+	changes := findBreakingChanges(from, to, rules)
+	for _, c := range changes {
+		fmt.Fprintln(w, c)
+	}
+	if len(changes) > 0 {
+		logWarn("breaking:", len(changes), "incompatible change(s) found")
+		return exitCompile
+	}
+	return 0
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func testField(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Type:   typ.Enum(),
+		Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	}
+}
+
+func testDescriptors() *descriptorpb.FileDescriptorSet {
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("payments/v1/api.proto"),
+		Package: proto.String("payments.v1"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Payment"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				testField("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				testField("amount", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+				testField("currency", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				testField("note", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			},
+			NestedType: []*descriptorpb.DescriptorProto{{Name: proto.String("Meta")}},
+		}},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Status"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("STATUS_UNSPECIFIED"), Number: proto.Int32(0)},
+				{Name: proto.String("STATUS_DONE"), Number: proto.Int32(1)},
+			},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Payments"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("Get"), InputType: proto.String(".payments.v1.Payment"), OutputType: proto.String(".payments.v1.Payment")},
+				{Name: proto.String("Delete"), InputType: proto.String(".payments.v1.Payment"), OutputType: proto.String(".payments.v1.Payment")},
+			},
+		}},
+	}}}
+}
+
+func TestFindBreakingChanges(t *testing.T) {
+	all, err := breakingConfig{}.enabled()
+	assert.NoError(t, err)
+	assert.Empty(t, findBreakingChanges(testDescriptors(), testDescriptors(), all))
+
+	to := testDescriptors()
+	f := to.File[0]
+	msg := f.MessageType[0]
+	msg.Field[1].Type = descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+	msg.Field[2].Number = proto.Int32(5)
+	msg.Field[3].Name = proto.String("comment")
+	msg.NestedType = nil
+	f.EnumType[0].Value[1].Number = proto.Int32(2)
+	f.Service[0].Method = f.Service[0].Method[:1]
+	f.Service[0].Method[0].ServerStreaming = proto.Bool(true)
+
+	changes := []string{}
+	for _, c := range findBreakingChanges(testDescriptors(), to, all) {
+		changes = append(changes, c.rule+" "+c.element)
+	}
+	assert.Equal(t, []string{
+		"FIELD_TYPE_CHANGED payments.v1.Payment.amount",
+		"FIELD_NUMBER_CHANGED payments.v1.Payment.currency",
+		"FIELD_NAME_CHANGED payments.v1.Payment.note",
+		"MESSAGE_REMOVED payments.v1.Payment.Meta",
+		"ENUM_VALUE_NUMBER_CHANGED payments.v1.Status.STATUS_DONE",
+		"RPC_SIGNATURE_CHANGED payments.v1.Payments.Get",
+		"RPC_REMOVED payments.v1.Payments.Delete",
+	}, changes)
+
+	wire, err := breakingConfig{Use: "wire", Except: []string{"RPC_REMOVED"}}.enabled()
+	assert.NoError(t, err)
+	changes = []string{}
+	for _, c := range findBreakingChanges(testDescriptors(), to, wire) {
+		changes = append(changes, c.rule+" "+c.element)
+	}
+	assert.Equal(t, []string{
+		"FIELD_TYPE_CHANGED payments.v1.Payment.amount",
+		"FIELD_NUMBER_CHANGED payments.v1.Payment.currency",
+		"ENUM_VALUE_NUMBER_CHANGED payments.v1.Status.STATUS_DONE",
+		"RPC_SIGNATURE_CHANGED payments.v1.Payments.Get",
+	}, changes)
+
+	to.File[0].Package = proto.String("payments.v2")
+	to.File[0].Name = proto.String("payments/v2/api.proto")
+	changes = []string{}
+	for _, c := range findBreakingChanges(testDescriptors(), to, all) {
+		changes = append(changes, c.rule)
+	}
+	assert.Contains(t, changes, "FILE_REMOVED")
+
+	_, err = breakingConfig{Use: "json"}.enabled()
+	assert.Error(t, err)
+	_, err = breakingConfig{Except: []string{"UNKNOWN"}}.enabled()
+	assert.Error(t, err)
+}
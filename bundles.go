@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//go:generate go run -tags generate gen.go bundles
+
+const bundlesDir = "bundles"
+
+// Optional third-party include sets, each one is a directory with the proto
+// files and a REVISION file recording the source module version.
+//
+//go:embed bundles
+var bundles embed.FS
+
+// bundleNames returns the names of the embedded include bundles.
+func bundleNames() []string {
+	names := []string{}
+	entries, _ := bundles.ReadDir(bundlesDir)
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// copyBundleToCache copies the named include bundle to the cache, unless the
+// cached copy has the same revision. Returns the include path of the bundle.
+func copyBundleToCache(name string) (string, error) {
+	src := path.Join(bundlesDir, name)
+	rev, err := fs.ReadFile(bundles, path.Join(src, "REVISION"))
+	if err != nil {
+		return "", fmt.Errorf("unknown include bundle %q, available bundles: %s", name, strings.Join(bundleNames(), ", "))
+	}
+	dst := cacheFile(bundlesDir, name)
+	if cached, err := ioutil.ReadFile(filepath.Join(dst, "REVISION")); err != nil || !bytes.Equal(cached, rev) {
+		if err := os.RemoveAll(dst); err != nil {
+			return "", err
+		}
+		err := fs.WalkDir(bundles, src, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || p == path.Join(src, "REVISION") {
+				return err
+			}
+			b, err := fs.ReadFile(bundles, p)
+			if err != nil {
+				return err
+			}
+			dstfp := filepath.Join(dst, filepath.FromSlash(strings.TrimPrefix(p, src+"/")))
+			if err := os.MkdirAll(filepath.Dir(dstfp), includesCacheDirPermission); err != nil {
+				return err
+			}
+			return ioutil.WriteFile(dstfp, b, includesCacheFilePermission)
+		})
+		if err != nil {
+			return "", err
+		}
+		// Revision is written last, so that partially copied bundles are
+		// copied again next time
+		if err := ioutil.WriteFile(filepath.Join(dst, "REVISION"), rev, includesCacheFilePermission); err != nil {
+			return "", err
+		}
+	}
+	logDebug("Using include bundle", name, strings.TrimSpace(string(rev)))
+	return dst, nil
+}
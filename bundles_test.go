@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyBundleToCache(t *testing.T) {
+	dir := t.TempDir()
+	defer func(f func() string) { cacheDir = f }(cacheDir)
+	cacheDir = func() string { return dir }
+
+	assert.Equal(t, []string{"googleapis", "openapiv2", "validate"}, bundleNames())
+
+	root, err := copyBundleToCache("googleapis")
+	assert.NoError(t, err)
+	assert.Equal(t, cacheFile("bundles", "googleapis"), root)
+	for _, f := range []string{"REVISION", "google/api/annotations.proto", "google/rpc/status.proto", "google/type/money.proto"} {
+		_, err := os.Stat(filepath.Join(root, filepath.FromSlash(f)))
+		assert.NoError(t, err, f)
+	}
+
+	// Outdated cached bundles are replaced
+	os.WriteFile(filepath.Join(root, "REVISION"), []byte("outdated"), 0644)
+	os.Remove(filepath.Join(root, "google", "type", "money.proto"))
+	_, err = copyBundleToCache("googleapis")
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(root, "google", "type", "money.proto"))
+	assert.NoError(t, err)
+
+	_, err = copyBundleToCache("unknown")
+	assert.Error(t, err)
+}
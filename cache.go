@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/sixt/protoc/v3/resolver"
+)
+
+// runCache implements `protoc cache warm [--platform=GOOS_GOARCH,...|all]
+// [<ref>...]`. It downloads the protoc binaries for the platforms, the
+// embedded includes and bundles, and the remote references from the arguments
+// and the "warm" section of the config into the cache. Cached protoc binaries
+// are verified, and downloaded again if they do not match their checksums.
+// Remote references are resolved even if they are replaced in the config.
+// Nothing is executed, so the cache can be prepared for other machines.
+func runCache(args []string, w io.Writer) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "USAGE: protoc cache warm [--platform=GOOS_GOARCH,...|all] [<ref>...]")
+		fmt.Fprintln(os.Stderr, "Platforms:", strings.Join(resolver.Platforms(), ", "))
+		return exitUsage
+	}
+	if len(args) == 0 || args[0] != "warm" {
+		return usage()
+	}
+	fs := flag.NewFlagSet("cache warm", flag.ContinueOnError)
+	platformList := fs.String("platform", runtime.GOOS+"_"+runtime.GOARCH, "comma-separated list of platforms, or all")
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+	platforms := strings.Split(*platformList, ",")
+	if *platformList == "all" {
+		platforms = resolver.Platforms()
+	}
+	known := map[string]bool{}
+	for _, p := range resolver.Platforms() {
+		known[p] = true
+	}
+	for _, p := range platforms {
+		if !known[p] {
+			logError("unknown platform:", p)
+			return usage()
+		}
+	}
+
+	// Failures are reported, and the rest of the cache is still warmed
+	code := 0
+	r := newResolver()
+	for _, p := range platforms {
+		if _, err := os.Stat(r.ProtocPath(version, p)); err == nil {
+			if err := r.VerifyProtocFor(runCtx, version, p); resolver.KindOf(err) == resolver.KindChecksum {
+				logWarn(p+":", err, "- downloading it again")
+				os.Remove(r.ProtocPath(version, p))
+			} else if err != nil {
+				code = fail(p+":", err)
+				continue
+			}
+		}
+		exe, err := r.DownloadProtocFor(runCtx, version, p)
+		if err != nil {
+			code = fail(p+":", err)
+			continue
+		}
+		fmt.Fprintln(w, exe)
+	}
+	if err := copyIncludesToCache(includesDir); err != nil {
+		code = fail(err)
+	}
+	for _, name := range cfg.Bundles {
+		if _, err := copyBundleToCache(name); err != nil {
+			code = fail(name+":", err)
+		}
+	}
+	for _, ref := range append(fs.Args(), cfg.Warm...) {
+		_, local, err := r.ResolveRoot(runCtx, pinRevision(ref))
+		if err != nil {
+			code = fail(ref+":", err)
+			continue
+		}
+		fmt.Fprintln(w, local)
+	}
+	return code
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sixt/protoc/v3/resolver"
+	"github.com/stretchr/testify/assert"
+)
+
+// warmedRefs are the references resolved by the "warm-test" source.
+var warmedRefs []string
+
+type warmSource struct{}
+
+func (warmSource) Resolve(ctx context.Context, ref string) (string, string, error) {
+	warmedRefs = append(warmedRefs, ref)
+	return "", cacheFile("repos", "warm-test"), nil
+}
+
+func init() {
+	resolver.RegisterSource("warm-test", func(r *resolver.Resolver) resolver.Source { return warmSource{} })
+}
+
+func TestRunCache(t *testing.T) {
+	dir := t.TempDir()
+	defer func(f func() string) { cacheDir = f }(cacheDir)
+	cacheDir = func() string { return dir }
+	defer func(c *config) { cfg = c }(cfg)
+	defer func(ctx context.Context) { runCtx = ctx }(runCtx)
+	warmedRefs = nil
+	cfg = &config{
+		Replace:   map[string]string{"github.com/org/contracts": filepath.Join(dir, "contracts")},
+		Revisions: map[string]string{"github.com/org/contracts": "v1.2.0"},
+		Sources:   map[string]string{"github.com/org/contracts": "warm-test"},
+		Warm:      []string{"github.com/org/contracts"},
+		Bundles:   []string{"validate"},
+	}
+
+	var out bytes.Buffer
+	assert.Equal(t, exitUsage, runCache(nil, &out))
+	assert.Equal(t, exitUsage, runCache([]string{"warm", "--platform=plan9_386"}, &out))
+
+	// Cached binaries matching their checksums are not downloaded again, and
+	// the replacements are bypassed
+	exe := cacheFile("protoc-" + version + "-linux_arm64.exe")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(exe), 0755))
+	assert.NoError(t, os.WriteFile(exe, []byte("protoc"), 0755))
+	assert.NoError(t, os.WriteFile(exe+".md5", []byte(fmt.Sprintf("%x", md5.Sum([]byte("protoc")))), 0644))
+	assert.Equal(t, 0, runCache([]string{"warm", "--platform=linux_arm64"}, &out))
+	assert.Equal(t, []string{exe, cacheFile("repos", "warm-test")}, strings.Fields(out.String()))
+	assert.Equal(t, []string{"github.com/org/contracts@v1.2.0"}, warmedRefs)
+	_, err := os.Stat(cacheFile("include", "google", "protobuf", "descriptor.proto"))
+	assert.NoError(t, err)
+	_, err = os.Stat(cacheFile("bundles", "validate", "REVISION"))
+	assert.NoError(t, err)
+
+	// Corrupted binaries are removed and downloaded again
+	assert.NoError(t, os.WriteFile(exe, nil, 0755))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runCtx = ctx
+	assert.NotEqual(t, 0, runCache([]string{"warm", "--platform=linux_arm64"}, &out))
+	_, err = os.Stat(exe)
+	assert.True(t, os.IsNotExist(err))
+}
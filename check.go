@@ -0,0 +1,257 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// checkOutput is an output directory from the command line and a scratch
+// directory used instead of it in check mode.
+type checkOutput struct {
+	dir     string
+	scratch string
+	// file is the name of the single output file in the directory, e.g. a
+	// descriptor set or a jar archive, if any.
+	file string
+}
+
+// isArchiveOutput returns true if the generator writes a jar or zip archive
+// instead of a directory, e.g. --java_out=gen/protos.jar.
+func isArchiveOutput(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".jar" || ext == ".zip"
+}
+
+// rewriteOutputs replaces the output directories of --X_out and
+// --descriptor_set_out flags with the scratch directories. The dependency file
+// of --dependency_out is written into the scratch directory as well.
+func rewriteOutputs(args []string, tmp string) ([]string, []checkOutput) {
+	out := []string{}
+	outputs := []checkOutput{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--") && strings.Contains(arg, "=") {
+			flag, value := arg[:strings.Index(arg, "=")], arg[strings.Index(arg, "=")+1:]
+			scratch := filepath.Join(tmp, strconv.Itoa(len(outputs)))
+			switch {
+			case flag == "--dependency_out":
+				arg = flag + "=" + filepath.Join(tmp, filepath.Base(value))
+			case flag == "--descriptor_set_out":
+				outputs = append(outputs, checkOutput{dir: filepath.Dir(value), scratch: scratch, file: filepath.Base(value)})
+				arg = flag + "=" + filepath.Join(scratch, filepath.Base(value))
+			case strings.HasSuffix(flag, "_out"):
+				opts := ""
+				if i := strings.LastIndex(value, ":"); i >= 0 && !filepath.IsAbs(value) {
+					opts, value = value[:i+1], value[i+1:]
+				}
+				if isArchiveOutput(value) {
+					outputs = append(outputs, checkOutput{dir: filepath.Dir(value), scratch: scratch, file: filepath.Base(value)})
+					arg = flag + "=" + opts + filepath.Join(scratch, filepath.Base(value))
+				} else {
+					outputs = append(outputs, checkOutput{dir: value, scratch: scratch})
+					arg = flag + "=" + opts + scratch
+				}
+			}
+		}
+		out = append(out, arg)
+	}
+	for _, o := range outputs {
+		os.MkdirAll(o.scratch, 0755)
+	}
+	return out, outputs
+}
+
+// previousOutputs returns the files generated by the previous invocation
+// with the same key, as recorded in its stamp and in the dependency file of
+// the --dependency_out flag, if any.
+func previousOutputs(key string, args []string) []string {
+	names := []string{}
+	if s, err := loadStamp(key); err == nil {
+		for name := range s.Outputs {
+			names = append(names, filepath.FromSlash(name))
+		}
+	}
+	if parsed, err := parseProtocArgs(args); err == nil {
+		for _, a := range parsed {
+			if a.flag != "--dependency_out" {
+				continue
+			}
+			if outputs, err := dependencyOutputs(a.value); err == nil {
+				names = append(names, outputs...)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// compareOutputs prints a unified diff for every generated file that differs
+// from the one in the working tree, including the stale files that were
+// generated by the previous invocation, but are no longer generated. Returns
+// the number of drifted files.
+func compareOutputs(outputs []checkOutput, previous []string) int {
+	abs := func(name string) string {
+		if p, err := filepath.Abs(name); err == nil {
+			return p
+		}
+		return name
+	}
+	drifted := 0
+	generated := map[string]bool{}
+	for _, o := range outputs {
+		if o.file != "" {
+			name := filepath.Join(o.dir, o.file)
+			generated[abs(name)] = true
+			if isArchiveOutput(o.file) {
+				drifted += compareArchives(name, filepath.Join(o.scratch, o.file))
+			} else if diffOutput(name, readOutput(name), readOutput(filepath.Join(o.scratch, o.file))) {
+				drifted++
+			}
+			continue
+		}
+		filepath.Walk(o.scratch, func(p string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(o.scratch, p)
+			if err != nil {
+				return err
+			}
+			name := filepath.Join(o.dir, rel)
+			generated[abs(name)] = true
+			if diffOutput(name, readOutput(name), readOutput(p)) {
+				drifted++
+			}
+			return nil
+		})
+	}
+	for _, name := range previous {
+		if generated[abs(name)] {
+			continue
+		}
+		// Reported once, even if recorded in both the stamp and the
+		// dependency file
+		generated[abs(name)] = true
+		if committed := readOutput(name); committed != nil && diffOutput(name, committed, nil) {
+			drifted++
+		}
+	}
+	return drifted
+}
+
+// compareArchives prints a unified diff for every entry of the generated jar
+// or zip archive that differs from the one in the working tree. Returns the
+// number of drifted entries.
+func compareArchives(committed, generated string) int {
+	from, to := readArchive(committed), readArchive(generated)
+	names := map[string]bool{}
+	for name := range from {
+		names[name] = true
+	}
+	for name := range to {
+		names[name] = true
+	}
+	drifted := 0
+	for _, name := range sortedKeys(names) {
+		if diffOutput(committed+"!/"+name, from[name], to[name]) {
+			drifted++
+		}
+	}
+	return drifted
+}
+
+// readArchive returns the contents of the files in the archive by name, or
+// nil if it can not be read.
+func readArchive(name string) map[string][]byte {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return nil
+	}
+	defer zr.Close()
+	files := map[string][]byte{}
+	for _, zf := range zr.File {
+		if strings.HasSuffix(zf.Name, "/") {
+			continue
+		}
+		f, err := zf.Open()
+		if err != nil {
+			continue
+		}
+		b, err := ioutil.ReadAll(f)
+		f.Close()
+		if err == nil {
+			files[zf.Name] = b
+		}
+	}
+	return files
+}
+
+// readOutput returns the contents of the output file, or nil if it does not
+// exist.
+func readOutput(name string) []byte {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil
+	}
+	if b == nil {
+		b = []byte{}
+	}
+	return b
+}
+
+// diffOutput prints a unified diff between the committed and the generated
+// contents of the file, nil meaning that the file does not exist. Returns
+// true if they differ.
+func diffOutput(name string, committed, generated []byte) bool {
+	if committed != nil && generated != nil && bytes.Equal(committed, generated) {
+		return false
+	}
+	fromName, toName := filepath.ToSlash(name), filepath.ToSlash(name)
+	if committed == nil {
+		fromName = "/dev/null"
+	}
+	if generated == nil {
+		toName = "/dev/null"
+	}
+	unifiedDiff(os.Stdout, fromName, toName, string(committed), string(generated))
+	return true
+}
+
+// checkProtoc generates the code into a scratch directory and compares it with
+// the files in the working tree without modifying them. Returns a non-zero
+// exit code if protoc fails or the files differ. The key identifies the
+// invocation, whose previous outputs are checked for stale files.
+func checkProtoc(protocExePath, key string, args, files []string) int {
+	tmp, err := ioutil.TempDir("", "protoc-check-")
+	if err != nil {
+		return fail(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	previous := previousOutputs(key, args)
+	args, outputs := rewriteOutputs(args, tmp)
+	if len(outputs) == 0 {
+		logError("check: no output flags")
+		return exitUsage
+	}
+	if len(files) == 0 {
+		if _, exitCode := execute(protocExePath, args...); exitCode != 0 {
+			return exitCode
+		}
+	}
+	for _, f := range files {
+		if _, exitCode := execute(protocExePath, appendFiles(args, virtualPath(f, includePaths(args)))...); exitCode != 0 {
+			return exitCode
+		}
+	}
+	if drifted := compareOutputs(outputs, previous); drifted > 0 {
+		logWarn("check:", drifted, "generated file(s) are out of date")
+		return exitCompile
+	}
+	return 0
+}
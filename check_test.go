@@ -0,0 +1,91 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteOutputs(t *testing.T) {
+	tmp := t.TempDir()
+	args, outputs := rewriteOutputs([]string{"-I=.", "--go_out=paths=source_relative:gen", "--descriptor_set_out=out/set.pb", "--java_out=lite:out/protos.jar", "--dependency_out=deps.d"}, tmp)
+	assert.Equal(t, []string{
+		"-I=.",
+		"--go_out=paths=source_relative:" + filepath.Join(tmp, "0"),
+		"--descriptor_set_out=" + filepath.Join(tmp, "1", "set.pb"),
+		"--java_out=lite:" + filepath.Join(tmp, "2", "protos.jar"),
+		"--dependency_out=" + filepath.Join(tmp, "deps.d"),
+	}, args)
+	assert.Equal(t, []checkOutput{
+		{dir: "gen", scratch: filepath.Join(tmp, "0")},
+		{dir: "out", scratch: filepath.Join(tmp, "1"), file: "set.pb"},
+		{dir: "out", scratch: filepath.Join(tmp, "2"), file: "protos.jar"},
+	}, outputs)
+}
+
+func TestCompareOutputs(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "gen"), 0755)
+	os.MkdirAll(filepath.Join(dir, "scratch"), 0755)
+	os.WriteFile(filepath.Join(dir, "gen", "same.go"), []byte("same"), 0644)
+	os.WriteFile(filepath.Join(dir, "scratch", "same.go"), []byte("same"), 0644)
+	outputs := []checkOutput{{dir: filepath.Join(dir, "gen"), scratch: filepath.Join(dir, "scratch")}}
+	assert.Equal(t, 0, compareOutputs(outputs, nil))
+
+	os.WriteFile(filepath.Join(dir, "gen", "changed.go"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(dir, "scratch", "changed.go"), []byte("new"), 0644)
+	os.WriteFile(filepath.Join(dir, "scratch", "missing.go"), []byte("new"), 0644)
+	assert.Equal(t, 2, compareOutputs(outputs, nil))
+
+	os.Remove(filepath.Join(dir, "scratch", "missing.go"))
+	os.WriteFile(filepath.Join(dir, "gen", "changed.go"), []byte("new"), 0644)
+	assert.Equal(t, 0, compareOutputs(outputs, nil))
+
+	// Files generated by the previous invocation are stale, other files in
+	// the output directory are not
+	stale, other := filepath.Join(dir, "gen", "stale.go"), filepath.Join(dir, "gen", "other.go")
+	os.WriteFile(stale, []byte("old"), 0644)
+	os.WriteFile(other, []byte("other"), 0644)
+	assert.Equal(t, 1, compareOutputs(outputs, []string{stale, stale, filepath.Join(dir, "gen", "same.go"), filepath.Join(dir, "gen", "removed.go")}))
+}
+
+func TestPreviousOutputs(t *testing.T) {
+	dir := t.TempDir()
+	defer func(f func() string) { cacheDir = f }(cacheDir)
+	cacheDir = func() string { return filepath.Join(dir, "cache") }
+	out := filepath.Join(dir, "foo.pb.go")
+	os.WriteFile(out, []byte("package foo"), 0644)
+	assert.NoError(t, saveStamp("key", "fp", []string{out}))
+	deps := filepath.Join(dir, "deps.d")
+	os.WriteFile(deps, []byte("gen/bar.pb.go: bar.proto\n"), 0644)
+
+	assert.Equal(t, []string{out}, previousOutputs("key", []string{"--go_out=" + dir}))
+	assert.Equal(t, []string{out, filepath.Join("gen", "bar.pb.go")}, previousOutputs("key", []string{"--go_out=" + dir, "--dependency_out=" + deps}))
+	assert.Empty(t, previousOutputs("other", nil))
+}
+
+func TestCompareArchives(t *testing.T) {
+	dir := t.TempDir()
+	writeJar := func(name string, files map[string]string) {
+		f, err := os.Create(name)
+		assert.NoError(t, err)
+		zw := zip.NewWriter(f)
+		for name, content := range files {
+			w, _ := zw.Create(name)
+			w.Write([]byte(content))
+		}
+		zw.Close()
+		f.Close()
+	}
+	os.MkdirAll(filepath.Join(dir, "scratch"), 0755)
+	writeJar(filepath.Join(dir, "protos.jar"), map[string]string{"com/example/Same.java": "same", "com/example/Stale.java": "old"})
+	writeJar(filepath.Join(dir, "scratch", "protos.jar"), map[string]string{"com/example/Same.java": "same", "com/example/New.java": "new"})
+	outputs := []checkOutput{{dir: dir, scratch: filepath.Join(dir, "scratch"), file: "protos.jar"}}
+	assert.Equal(t, 2, compareOutputs(outputs, nil))
+
+	writeJar(filepath.Join(dir, "protos.jar"), map[string]string{"com/example/Same.java": "same", "com/example/New.java": "new"})
+	assert.Equal(t, 0, compareOutputs(outputs, nil))
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const configFileName = ".protoc.json"
+
+// config is the optional wrapper configuration. It is read from the
+// `.protoc.json` file found in the current directory or any of its parents,
+// or from the file specified by `$PROTOC_CONFIG`.
+type config struct {
+	// Replace maps remote repository prefixes to local directories, similarly
+	// to the replace directives in go.mod.
+	Replace map[string]string `json:"replace,omitempty"`
+	// Revisions pins remote repository prefixes to the revisions used when
+	// fetching imports of the proto files.
+	Revisions map[string]string `json:"revisions,omitempty"`
+	// Roots maps remote repository prefixes to include roots relative to
+	// them, e.g. "proto" if all imports are relative to the proto directory.
+	Roots map[string]string `json:"roots,omitempty"`
+	// Sources maps remote repository prefixes or URL schemes to the names of
+	// the sources that resolve them, e.g. "hg" for Mercurial repositories or
+	// "go-git" to clone particular hosts with the go-git library.
+	Sources map[string]string `json:"sources,omitempty"`
+	// MavenRepository is the URL of the Maven repository used to download
+	// proto artifacts, Maven Central by default.
+	MavenRepository string `json:"mavenRepository,omitempty"`
+	// Warm is the list of remote references fetched into the cache by the
+	// `protoc cache warm` command.
+	Warm []string `json:"warm,omitempty"`
+	// Bundles is the list of embedded third-party include bundles to use,
+	// e.g. "googleapis".
+	Bundles []string `json:"bundles,omitempty"`
+	// Breaking selects the rules of the `protoc breaking` command.
+	Breaking breakingConfig `json:"breaking,omitempty"`
+	// Lint enables or disables the rules of the `protoc lint` command.
+	Lint lintConfig `json:"lint,omitempty"`
+	// ProtocVersionCheck is the strictness of the version check of the
+	// protoc binary from $PROTOC_BIN or PATH: "exact", "major" or "any".
+	ProtocVersionCheck string `json:"protocVersionCheck,omitempty"`
+}
+
+// cfg is the configuration used by the current wrapper invocation.
+var cfg = &config{}
+
+// configCeiling is the last directory searched for the configuration file,
+// the filesystem root if empty.
+var configCeiling = ""
+
+// findConfig returns a path to the configuration file, or an empty string if
+// there is none.
+func findConfig() string {
+	if path := os.Getenv("PROTOC_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, configFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir || dir == configCeiling {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// loadConfig reads the configuration file and applies overrides from the
+// environment variables.
+func loadConfig() (*config, error) {
+	c := &config{}
+	if path := findConfig(); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, c); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		// Relative local paths are resolved against the config file location
+		for prefix, dir := range c.Replace {
+			if !filepath.IsAbs(dir) {
+				c.Replace[prefix] = filepath.Join(filepath.Dir(path), dir)
+			}
+		}
+	}
+	// PROTOC_REPLACE=github.com/org/repo=../repo,github.com/org/other=/src/other
+	if env := os.Getenv("PROTOC_REPLACE"); env != "" {
+		if c.Replace == nil {
+			c.Replace = map[string]string{}
+		}
+		for _, rule := range strings.Split(env, ",") {
+			parts := strings.SplitN(rule, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return nil, fmt.Errorf("malformed PROTOC_REPLACE rule: %q", rule)
+			}
+			c.Replace[parts[0]] = parts[1]
+		}
+	}
+	return c, nil
+}
+
+// matchPrefix returns the longest prefix from the map keys that matches the
+// URL on a path element boundary, and the remainder of the URL.
+func matchPrefix(m map[string]string, url string) (string, string, bool) {
+	prefixes := make([]string, 0, len(m))
+	for prefix := range m {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	for _, prefix := range prefixes {
+		p := strings.TrimSuffix(prefix, "/")
+		if url == p {
+			return prefix, "", true
+		}
+		if strings.HasPrefix(url, p+"/") {
+			return prefix, url[len(p)+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// replace returns a local path for the remote URL if it matches one of the
+// replace rules. The longest matching prefix wins.
+func (c *config) replace(url string) (string, bool) {
+	prefix, rest, ok := matchPrefix(c.Replace, url)
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(c.Replace[prefix], filepath.FromSlash(rest)), true
+}
+
+// revision returns the pinned revision for the remote URL, or an empty string
+// if the default branch should be used.
+func (c *config) revision(url string) string {
+	if prefix, _, ok := matchPrefix(c.Revisions, url); ok {
+		return c.Revisions[prefix]
+	}
+	return ""
+}
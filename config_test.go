@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// inTempDir runs the test in a temporary directory, which is also the last
+// directory searched for the config file.
+func inTempDir(t *testing.T) string {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	assert.NoError(t, err)
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+	ceiling := configCeiling
+	configCeiling = dir
+	t.Cleanup(func() { configCeiling = ceiling })
+	return dir
+}
+
+func TestConfigReplace(t *testing.T) {
+	dir := inTempDir(t)
+	os.Setenv("PROTOC_CONFIG", filepath.Join(dir, "missing.json"))
+	defer os.Unsetenv("PROTOC_CONFIG")
+	os.Setenv("PROTOC_REPLACE", "github.com/org/repo=/src/repo,github.com/org/repo/sub=/src/sub")
+	defer os.Unsetenv("PROTOC_REPLACE")
+
+	c, err := loadConfig()
+	assert.Error(t, err)
+
+	os.Unsetenv("PROTOC_CONFIG")
+	c, err = loadConfig()
+	assert.NoError(t, err)
+
+	for _, test := range []struct {
+		URL   string
+		Local string
+	}{
+		{URL: "github.com/org/repo", Local: "/src/repo"},
+		{URL: "github.com/org/repo/foo.proto", Local: filepath.Join("/src/repo", "foo.proto")},
+		{URL: "github.com/org/repo/sub/foo.proto", Local: filepath.Join("/src/sub", "foo.proto")},
+		{URL: "github.com/org/repository/foo.proto"},
+		{URL: "github.com/org/other/foo.proto"},
+	} {
+		local, ok := c.replace(test.URL)
+		assert.Equal(t, test.Local != "", ok, test.URL)
+		assert.Equal(t, test.Local, local, test.URL)
+	}
+
+	os.Setenv("PROTOC_REPLACE", "github.com/org/repo")
+	_, err = loadConfig()
+	assert.Error(t, err)
+}
+
+func TestFindConfig(t *testing.T) {
+	dir := inTempDir(t)
+	assert.Equal(t, "", findConfig())
+
+	// The config file is found in the parent directories, and relative
+	// replacements are resolved against its location
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, configFileName), []byte(`{"replace": {"github.com/org/repo": "repo"}}`), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	assert.NoError(t, os.Chdir(filepath.Join(dir, "sub")))
+	assert.Equal(t, filepath.Join(dir, configFileName), findConfig())
+	c, err := loadConfig()
+	assert.NoError(t, err)
+	local, ok := c.replace("github.com/org/repo/foo.proto")
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(dir, "repo", "foo.proto"), local)
+}
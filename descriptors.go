@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// compileDescriptors resolves the local or remote references, compiles them
+// with protoc and returns the resulting descriptor set. Local directories are
+// also used as include paths, so that file names in the descriptors are
+// relative to them.
+func compileDescriptors(protocExePath string, refs []string, sourceInfo bool) (*descriptorpb.FileDescriptorSet, error) {
+	tmp, err := ioutil.TempDir("", "protoc-descriptors-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	in := []string{}
+	for _, ref := range refs {
+		if info, err := os.Stat(ref); err == nil && info.IsDir() {
+			in = append(in, "-I="+ref)
+		}
+		in = append(in, ref)
+	}
+	args, files, err := processArgs(in)
+	if err != nil {
+		return nil, err
+	}
+	files = expandDirs(files)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no proto files found: %v", refs)
+	}
+	out := filepath.Join(tmp, "descriptors.pb")
+	args = append(args, "--descriptor_set_out="+out)
+	if sourceInfo {
+		args = append(args, "--include_source_info")
+	}
+	includes := includePaths(args)
+	names := []string{}
+	for _, f := range files {
+		names = append(names, virtualPath(f, includes))
+	}
+	args = appendFiles(args, names...)
+	if _, exitCode := execute(protocExePath, args...); exitCode != 0 {
+		return nil, &compileError{exitCode: exitCode}
+	}
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(b, set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
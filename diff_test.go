@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	for _, test := range []struct {
+		From string
+		To   string
+		Diff string
+	}{
+		{From: "a\nb\nc\n", To: "a\nb\nc\n", Diff: ""},
+		{From: "", To: "a\n", Diff: "@@ -0,0 +1,1 @@\n+a\n"},
+		{From: "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n", To: "a\nB\nc\nd\ne\nf\ng\nh\ni\nJ\n",
+			Diff: "@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n@@ -7,4 +7,4 @@\n g\n h\n i\n-j\n+J\n"},
+		{From: "a\nb", To: "a\nc", Diff: "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n"},
+	} {
+		var buf bytes.Buffer
+		unifiedDiff(&buf, "from", "to", test.From, test.To)
+		assert.Equal(t, "--- from\n+++ to\n"+test.Diff, buf.String())
+	}
+}
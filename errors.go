@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/sixt/protoc/v3/resolver"
+)
+
+// Exit codes of the wrapper. Protoc exits with 1 when it finds errors in the
+// proto files, the other codes tell why the wrapper itself failed.
+const (
+	exitCompile  = 1
+	exitUsage    = 2
+	exitNetwork  = 3
+	exitAuth     = 4
+	exitNotFound = 5
+	exitRevision = 6
+	exitChecksum = 7
+	exitWrapper  = 8
+	exitTimeout  = 124
+)
+
+var kindExitCodes = map[resolver.Kind]int{
+	resolver.KindNetwork:          exitNetwork,
+	resolver.KindAuth:             exitAuth,
+	resolver.KindNotFound:         exitNotFound,
+	resolver.KindRevisionNotFound: exitRevision,
+	resolver.KindChecksum:         exitChecksum,
+}
+
+// compileError is returned when protoc fails on the proto files.
+type compileError struct {
+	exitCode int
+}
+
+func (e *compileError) Error() string {
+	return fmt.Sprintf("protoc failed: exit code %d", e.exitCode)
+}
+
+// usageError is an invalid command line or configuration.
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string { return e.err.Error() }
+func (e *usageError) Unwrap() error { return e.err }
+
+// exitCodeOf returns the exit code for the error. Interrupted runs exit like a
+// process killed by the received signal.
+func exitCodeOf(err error) int {
+	if runCtx.Err() != nil {
+		// Failures of an interrupted run are caused by the interruption
+		err = runCtx.Err()
+	}
+	var compileErr *compileError
+	var usageErr *usageError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return exitTimeout
+	case errors.Is(err, context.Canceled):
+		if sig, ok := interrupt.Load().(syscall.Signal); ok {
+			return 128 + int(sig)
+		}
+		return 128 + int(syscall.SIGINT)
+	case errors.As(err, &compileErr):
+		return compileErr.exitCode
+	}
+	// Remote response files make resolution errors possible in the usage
+	if code, ok := kindExitCodes[resolver.KindOf(err)]; ok {
+		return code
+	}
+	if errors.As(err, &usageErr) {
+		return exitUsage
+	}
+	return exitWrapper
+}
+
+// fail logs the error and returns its exit code.
+func fail(v ...interface{}) int {
+	logError(v...)
+	for _, arg := range v {
+		if err, ok := arg.(error); ok {
+			return exitCodeOf(err)
+		}
+	}
+	return exitWrapper
+}
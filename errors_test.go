@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/sixt/protoc/v3/resolver"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCode(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		code int
+	}{
+		{&compileError{exitCode: 1}, exitCompile},
+		{fmt.Errorf("foo.proto: %w", &compileError{exitCode: 1}), exitCompile},
+		{&usageError{errors.New("missing value for flag: -I")}, exitUsage},
+		{&usageError{resolver.NewError("github.com/org/repo/args.txt", &resolver.Error{Kind: resolver.KindNotFound})}, exitNotFound},
+		{resolver.NewError("github.com/org/repo", &resolver.Error{Kind: resolver.KindNetwork}), exitNetwork},
+		{&resolver.Error{Kind: resolver.KindAuth}, exitAuth},
+		{&resolver.Error{Kind: resolver.KindRevisionNotFound}, exitRevision},
+		{&resolver.Error{Kind: resolver.KindChecksum}, exitChecksum},
+		{errors.New("permission denied"), exitWrapper},
+		{fmt.Errorf("git failed: %w", context.DeadlineExceeded), exitTimeout},
+	} {
+		assert.Equal(t, test.code, exitCodeOf(test.err), test.err.Error())
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// builtinGenerators are the code generators built into protoc, they do not
+// need a plugin binary.
+var builtinGenerators = map[string]bool{
+	"cpp": true, "csharp": true, "java": true, "js": true, "kotlin": true,
+	"objc": true, "php": true, "pyi": true, "python": true, "ruby": true,
+}
+
+// stamp is the fingerprint of the inputs and the checksums of the outputs of
+// a single protoc invocation.
+type stamp struct {
+	Fingerprint string            `json:"fingerprint"`
+	Outputs     map[string]string `json:"outputs"`
+}
+
+// outputDirs returns the output directories from the --X_out and
+// --descriptor_set_out flags. The dependency file of --dependency_out is not
+// a generated output.
+func outputDirs(args []string) []string {
+	dirs := []string{}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") || !strings.Contains(arg, "=") {
+			continue
+		}
+		flag, value := arg[:strings.Index(arg, "=")], arg[strings.Index(arg, "=")+1:]
+		switch {
+		case flag == "--dependency_out":
+		case flag == "--descriptor_set_out":
+			dirs = append(dirs, filepath.Dir(value))
+		case strings.HasSuffix(flag, "_out"):
+			// Generator options may precede the directory: --go_out=paths=import:dir
+			if i := strings.LastIndex(value, ":"); i >= 0 && !filepath.IsAbs(value) {
+				value = value[i+1:]
+			}
+			dirs = append(dirs, value)
+		}
+	}
+	return dirs
+}
+
+// pluginPaths returns the plugin binaries used by the --X_out flags.
+func pluginPaths(args []string) []string {
+	plugins := map[string]string{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--plugin=") {
+			if parts := strings.SplitN(strings.TrimPrefix(arg, "--plugin="), "=", 2); len(parts) == 2 {
+				plugins[parts[0]] = parts[1]
+			}
+		}
+	}
+	paths := []string{}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") || !strings.Contains(arg, "_out=") {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(arg[:strings.Index(arg, "=")], "--"), "_out")
+		if builtinGenerators[name] || name == "descriptor_set" {
+			continue
+		}
+		if p, ok := plugins["protoc-gen-"+name]; ok {
+			paths = append(paths, p)
+		} else if p, err := exec.LookPath("protoc-gen-" + name); err == nil {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+func hashFile(h io.Writer, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(h, f)
+	return err
+}
+
+// fingerprint computes a checksum of the protoc binary, the final argument
+// list, the plugin binaries, the input descriptor sets and all the input files
+// including their transitive imports. The binary itself is hashed, since it
+// may come from PROTOC_BIN or PATH rather than match the wrapper version.
+func fingerprint(protocExePath string, args, files []string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintln(h, "protoc", protocExePath)
+	if err := hashFile(h, protocExePath); err != nil {
+		return "", err
+	}
+	for _, arg := range args {
+		fmt.Fprintln(h, "arg", arg)
+	}
+	for _, plugin := range pluginPaths(args) {
+		fmt.Fprintln(h, "plugin", plugin)
+		if err := hashFile(h, plugin); err != nil {
+			return "", err
+		}
+	}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--descriptor_set_in=") {
+			continue
+		}
+		for _, set := range filepath.SplitList(strings.TrimPrefix(arg, "--descriptor_set_in=")) {
+			fmt.Fprintln(h, "descriptor_set", set)
+			if err := hashFile(h, set); err != nil {
+				return "", err
+			}
+		}
+	}
+	fetcher := newImportFetcher(includePaths(args))
+	for _, f := range files {
+		if err := fetcher.fetch(f); err != nil {
+			return "", err
+		}
+	}
+	inputs := []string{}
+	for f := range fetcher.visited {
+		inputs = append(inputs, f)
+	}
+	sort.Strings(inputs)
+	for _, f := range inputs {
+		fmt.Fprintln(h, "file", f)
+		if err := hashFile(h, f); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// stampKey identifies the protoc invocation by its original arguments and the
+// working directory.
+func stampKey(args []string) string {
+	cwd, _ := os.Getwd()
+	key := []string{cwd}
+	for _, arg := range args {
+		if arg != "--force" {
+			key = append(key, arg)
+		}
+	}
+	h := sha256.Sum256([]byte(strings.Join(key, "\x00")))
+	return hex.EncodeToString(h[:8])
+}
+
+// stampFile returns the path of the cached stamp of the invocation.
+func stampFile(key string) string {
+	return cacheFile("stamps", key+".json")
+}
+
+// loadStamp reads the cached stamp of the invocation.
+func loadStamp(key string) (stamp, error) {
+	s := stamp{}
+	b, err := ioutil.ReadFile(stampFile(key))
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(b, &s)
+	return s, err
+}
+
+// upToDate returns true if the previous invocation with the same key had the
+// same fingerprint, and its outputs have not been changed since then.
+func upToDate(key, fp string) bool {
+	s, err := loadStamp(key)
+	if err != nil || s.Fingerprint != fp || len(s.Outputs) == 0 {
+		return false
+	}
+	for name, sum := range s.Outputs {
+		h := sha256.New()
+		if err := hashFile(h, filepath.FromSlash(name)); err != nil {
+			return false
+		}
+		if hex.EncodeToString(h.Sum(nil)) != sum {
+			return false
+		}
+	}
+	return true
+}
+
+// saveStamp records the fingerprint and the checksums of the files generated
+// by protoc into the cache.
+func saveStamp(key, fp string, outputs []string) error {
+	s := stamp{Fingerprint: fp, Outputs: map[string]string{}}
+	for _, name := range outputs {
+		h := sha256.New()
+		if err := hashFile(h, name); err != nil {
+			return err
+		}
+		s.Outputs[filepath.ToSlash(name)] = hex.EncodeToString(h.Sum(nil))
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(stampFile(key)), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(stampFile(key), b, 0644)
+}
+
+// dependencyOutputs returns the files generated by protoc from the make-style
+// dependency file written by --dependency_out, i.e. the targets of the rule.
+func dependencyOutputs(file string) ([]string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	src := strings.ReplaceAll(strings.ReplaceAll(string(b), "\\\r\n", " "), "\\\n", " ")
+	outputs := []string{}
+	name := strings.Builder{}
+	for i := 0; i < len(src); i++ {
+		switch c := src[i]; {
+		case c == '\\' && i+1 < len(src) && src[i+1] == ' ':
+			name.WriteByte(' ')
+			i++
+		case c == ':' && (i+1 == len(src) || src[i+1] == ' ' || src[i+1] == '\n'):
+			if name.Len() > 0 {
+				outputs = append(outputs, name.String())
+			}
+			return outputs, nil
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if name.Len() > 0 {
+				outputs = append(outputs, name.String())
+				name.Reset()
+			}
+		default:
+			name.WriteByte(c)
+		}
+	}
+	return nil, fmt.Errorf("%s: malformed dependency file", file)
+}
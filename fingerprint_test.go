@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputDirs(t *testing.T) {
+	assert.Equal(t, []string{"gen", "out/go", "out"}, outputDirs([]string{
+		"-I=.", "--java_out=gen", "--go_out=paths=source_relative:out/go", "--go_opt=foo", "--descriptor_set_out=out/set.pb", "--dependency_out=deps/foo.d",
+	}))
+}
+
+func TestStamp(t *testing.T) {
+	dir := t.TempDir()
+	defer func(f func() string) { cacheDir = f }(cacheDir)
+	cacheDir = func() string { return filepath.Join(dir, "cache") }
+	src := filepath.Join(dir, "foo.proto")
+	os.WriteFile(src, []byte(`syntax = "proto3";`), 0644)
+	args := []string{"--java_out=" + dir}
+	exe := filepath.Join(dir, "protoc")
+	os.WriteFile(exe, []byte("protoc 22.2"), 0755)
+
+	fp, err := fingerprint(exe, args, []string{src})
+	assert.NoError(t, err)
+	key := stampKey(args)
+	assert.Equal(t, key, stampKey(append(args, "--force")))
+	assert.False(t, upToDate(key, fp))
+
+	out := filepath.Join(dir, "Foo.java")
+	os.WriteFile(out, []byte("class Foo {}"), 0644)
+	// Files not generated by this invocation are not recorded
+	os.WriteFile(filepath.Join(dir, "Other.java"), []byte("class Other {}"), 0644)
+	assert.NoError(t, saveStamp(key, fp, []string{out}))
+	assert.True(t, upToDate(key, fp))
+	os.WriteFile(filepath.Join(dir, "Other.java"), []byte("class Changed {}"), 0644)
+	assert.True(t, upToDate(key, fp))
+	_, err = os.Stat(filepath.Join(dir, ".protoc.sum"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Changed outputs
+	os.WriteFile(out, []byte("class Bar {}"), 0644)
+	assert.False(t, upToDate(key, fp))
+	os.WriteFile(out, []byte("class Foo {}"), 0644)
+
+	// Changed inputs
+	os.WriteFile(src, []byte(`syntax = "proto2";`), 0644)
+	fp2, err := fingerprint(exe, args, []string{src})
+	assert.NoError(t, err)
+	assert.NotEqual(t, fp, fp2)
+	assert.False(t, upToDate(key, fp2))
+
+	// Changed protoc binary
+	os.WriteFile(exe, []byte("protoc 21.12"), 0755)
+	fp3, err := fingerprint(exe, args, []string{src})
+	assert.NoError(t, err)
+	assert.NotEqual(t, fp2, fp3)
+}
+
+func TestDependencyOutputs(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "deps")
+	os.WriteFile(file, []byte("gen/foo.pb.go \\\n gen/my\\ dir/foo_grpc.pb.go: \\\n  foo.proto \\\n  google/protobuf/empty.proto\n"), 0644)
+	outputs, err := dependencyOutputs(file)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gen/foo.pb.go", "gen/my dir/foo_grpc.pb.go"}, outputs)
+
+	os.WriteFile(file, []byte("gen/foo.pb.go"), 0644)
+	_, err = dependencyOutputs(file)
+	assert.Error(t, err)
+}
@@ -10,14 +10,46 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 )
 
 const (
 	protoIncludesBaseUrl = "https://github.com/protocolbuffers/protobuf/releases/download"
 	includesDir          = "include"
+	bundlesDir           = "bundles"
+	goProxyBaseUrl       = "https://proxy.golang.org"
 )
 
+// bundle is a named set of third-party proto includes taken from the
+// top-level files of the given directories of a Go module.
+type bundle struct {
+	module  string
+	version string
+	dirs    []string
+}
+
+// Keep bundle revisions pinned, the revision is recorded in the REVISION file
+// of each bundle.
+var bundles = map[string]bundle{
+	"googleapis": {
+		module:  "github.com/googleapis/googleapis",
+		version: "v0.0.0-20260421182001-939ba3bf8408",
+		dirs:    []string{"google/api", "google/rpc", "google/type"},
+	},
+	"validate": {
+		module:  "github.com/envoyproxy/protoc-gen-validate",
+		version: "v1.0.2",
+		dirs:    []string{"validate"},
+	},
+	"openapiv2": {
+		module:  "github.com/grpc-ecosystem/grpc-gateway/v2",
+		version: "v2.18.0",
+		dirs:    []string{"protoc-gen-openapiv2/options"},
+	},
+}
+
 func download(url string) ([]byte, error) {
 	res, err := http.Get(url)
 	if err != nil {
@@ -29,12 +61,63 @@ func download(url string) ([]byte, error) {
 
 func main() {
 	if len(os.Args) != 2 {
-		log.Fatal("USAGE: go run -tags generate gen.go <version>")
+		log.Fatal("USAGE: go run -tags generate gen.go <version>|bundles")
+	}
+	if os.Args[1] == "bundles" {
+		generateBundles()
+		return
 	}
 	version := os.Args[1]
 	generateProtoIncludes(version)
 }
 
+func generateBundles() {
+	if err := os.RemoveAll(bundlesDir); err != nil {
+		log.Fatal(err)
+	}
+	for name, b := range bundles {
+		url := fmt.Sprintf("%s/%s/@v/%s.zip", goProxyBaseUrl, b.module, b.version)
+		log.Println("Downloading bundle", name, "from", url)
+		body, err := download(url)
+		if err != nil {
+			log.Fatal(err)
+		}
+		zipReader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			log.Fatal(err)
+		}
+		prefix := b.module + "@" + b.version + "/"
+		for _, zipFile := range zipReader.File {
+			file := strings.TrimPrefix(zipFile.Name, prefix)
+			if path.Ext(file) != ".proto" || !contains(b.dirs, path.Dir(file)) {
+				continue
+			}
+			unzippedFileBytes, err := readZipFile(zipFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			writeFile(filepath.Join(bundlesDir, name, filepath.FromSlash(file)), unzippedFileBytes)
+		}
+		writeFile(filepath.Join(bundlesDir, name, "REVISION"), []byte(b.module+"@"+b.version+"\n"))
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func writeFile(name string, b []byte) {
+	ensureDir(name)
+	if err := os.WriteFile(name, b, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
 func generateProtoIncludes(version string) {
 	// any arch for which distribution is packaged can be used. All contain same protos
 	arch := "linux-x86_64"
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"strings"
@@ -107,4 +108,20 @@ func TestDownload(t *testing.T) {
 			t.Fatal(local)
 		}
 	}
+
+	// Remote include paths are checked out at the requested revision
+	out, _, err := processArgs([]string{"-I", gitAddr + "/testrepo@v1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out[0] != "-I=testcache/protoc/"+version+"/repos/"+gitAddr+"/testrepo" {
+		t.Fatal(out)
+	}
+	head, err := gitHead("testcache/protoc/" + version + "/repos/" + gitAddr + "/testrepo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag, _ := exec.Command("git", "-C", "testrepo", "rev-parse", "v1.0.0^{commit}").Output(); strings.TrimSpace(string(tag)) != head {
+		t.Fatal(head, tag)
+	}
 }
@@ -5,6 +5,7 @@ go 1.18
 require (
 	github.com/go-git/go-git/v5 v5.6.1
 	github.com/stretchr/testify v1.7.0
+	google.golang.org/protobuf v1.30.0
 )
 
 require (
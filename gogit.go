@@ -0,0 +1,9 @@
+//go:build gogit
+
+package main
+
+// Builds with the gogit constraint use the go-git library by default, as they
+// did before both git implementations were available at runtime.
+func init() {
+	defaultSource = "go-git"
+}
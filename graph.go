@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var protoDefinition = regexp.MustCompile(`\b(message|enum|service)\s+([A-Za-z_][A-Za-z0-9_]*)\s*\{`)
+
+// parseDefinitions returns the fully qualified names of the top-level
+// messages, enums and services defined in the proto file.
+func parseDefinitions(file string) ([]string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	src := protoComments.ReplaceAllString(string(b), "")
+	prefix := ""
+	if m := protoPackage.FindStringSubmatch(src); m != nil {
+		prefix = m[1] + "."
+	}
+	names := []string{}
+	depth, pos := 0, 0
+	for _, m := range protoDefinition.FindAllStringSubmatchIndex(src, -1) {
+		depth += strings.Count(src[pos:m[0]], "{") - strings.Count(src[pos:m[0]], "}")
+		pos = m[0]
+		if depth == 0 {
+			names = append(names, prefix+src[m[4]:m[5]])
+		}
+	}
+	return names, nil
+}
+
+// graphNode is a single proto file of the import graph, identified by its
+// import path.
+type graphNode struct {
+	Name       string   `json:"name"`
+	File       string   `json:"file,omitempty"`
+	Origin     string   `json:"origin,omitempty"`
+	Imports    []string `json:"imports"`
+	Missing    bool     `json:"missing,omitempty"`
+	Duplicates []string `json:"duplicates,omitempty"`
+}
+
+// importGraph is the import graph of the given files, as protoc would resolve
+// it using the include paths.
+type importGraph struct {
+	Roots []string     `json:"roots"`
+	Nodes []*graphNode `json:"nodes"`
+
+	includes []string
+	nodes    map[string]*graphNode
+}
+
+// virtualName returns the import path of the file relative to the first
+// include path that contains it.
+func (g *importGraph) virtualName(file string) string {
+	for _, dir := range g.includes {
+		if rel, ok := relUnder(dir, file); ok {
+			return rel
+		}
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, ok := relUnder(cwd, file); ok {
+			return rel
+		}
+	}
+	return filepath.ToSlash(file)
+}
+
+func (g *importGraph) add(name, file string) *graphNode {
+	if n, ok := g.nodes[name]; ok {
+		return n
+	}
+	n := &graphNode{Name: name, File: file, Imports: []string{}}
+	g.nodes[name] = n
+	g.Nodes = append(g.Nodes, n)
+	if file == "" {
+		n.Missing = true
+		return n
+	}
+	n.Origin = fileOrigin(file).String()
+	imports, err := parseImports(file)
+	if err != nil {
+		n.Missing = true
+		return n
+	}
+	for _, imp := range imports {
+		n.Imports = append(n.Imports, imp)
+		matches := []string{}
+		for _, dir := range g.includes {
+			p := filepath.Join(dir, filepath.FromSlash(imp))
+			if info, err := os.Stat(p); err == nil && !info.IsDir() {
+				matches = append(matches, p)
+			}
+		}
+		if len(matches) == 0 {
+			g.add(imp, "")
+			continue
+		}
+		dep := g.add(imp, matches[0])
+		for _, p := range matches[1:] {
+			dep.Duplicates = appendUnique(dep.Duplicates, "shadows "+p)
+		}
+	}
+	return n
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, item := range list {
+		if item == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// buildGraph resolves the files and their transitive imports using the
+// include paths, and marks the files that can not be found, are shadowed by
+// other files with the same import path, or define the same types as other
+// files.
+func buildGraph(includes, files []string) *importGraph {
+	g := &importGraph{Roots: []string{}, nodes: map[string]*graphNode{}}
+	for _, dir := range includes {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		g.includes = append(g.includes, dir)
+	}
+	for _, file := range files {
+		if abs, err := filepath.Abs(file); err == nil {
+			file = abs
+		}
+		name := g.virtualName(file)
+		g.Roots = append(g.Roots, name)
+		g.add(name, file)
+	}
+	defined := map[string][]string{}
+	for _, n := range g.Nodes {
+		if n.Missing {
+			continue
+		}
+		names, _ := parseDefinitions(n.File)
+		for _, name := range names {
+			defined[name] = append(defined[name], n.Name)
+		}
+	}
+	for _, name := range sortedKeys(defined) {
+		files := defined[name]
+		if len(files) < 2 {
+			continue
+		}
+		for _, f := range files {
+			for _, other := range files {
+				if other != f {
+					g.nodes[f].Duplicates = appendUnique(g.nodes[f].Duplicates, name+" is also defined in "+other)
+				}
+			}
+		}
+	}
+	return g
+}
+
+// problems returns the number of missing and duplicate nodes.
+func (g *importGraph) problems() int {
+	count := 0
+	for _, n := range g.Nodes {
+		if n.Missing || len(n.Duplicates) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func (n *graphNode) String() string {
+	s := n.Name
+	if n.Missing {
+		return s + " [missing]"
+	}
+	s = s + " (" + n.Origin + ")"
+	if len(n.Duplicates) > 0 {
+		s = s + " [duplicate: " + strings.Join(n.Duplicates, "; ") + "]"
+	}
+	return s
+}
+
+func (g *importGraph) writeTree(w io.Writer) {
+	shown := map[string]bool{}
+	var walk func(name, indent string, last bool, top bool)
+	walk = func(name, indent string, last bool, top bool) {
+		n := g.nodes[name]
+		prefix, childIndent := "", ""
+		if !top {
+			if last {
+				prefix, childIndent = indent+"└── ", indent+"    "
+			} else {
+				prefix, childIndent = indent+"├── ", indent+"│   "
+			}
+		}
+		if shown[name] && len(n.Imports) > 0 {
+			// Imports of the file have been printed already
+			fmt.Fprintf(w, "%s%s ...\n", prefix, n)
+			return
+		}
+		fmt.Fprintf(w, "%s%s\n", prefix, n)
+		shown[name] = true
+		for i, imp := range n.Imports {
+			walk(imp, childIndent, i == len(n.Imports)-1, false)
+		}
+	}
+	for _, root := range g.Roots {
+		walk(root, "", true, true)
+	}
+}
+
+func (g *importGraph) writeDot(w io.Writer) {
+	fmt.Fprintln(w, "digraph imports {")
+	fmt.Fprintln(w, "  node [shape=box];")
+	for _, n := range g.Nodes {
+		attrs := "label=" + strconv.Quote(n.Name+"\n"+n.Origin)
+		switch {
+		case n.Missing:
+			attrs = "label=" + strconv.Quote(n.Name+"\nmissing") + ", color=red, style=dashed"
+		case len(n.Duplicates) > 0:
+			attrs += ", color=orange, style=bold, tooltip=" + strconv.Quote(strings.Join(n.Duplicates, "\n"))
+		}
+		fmt.Fprintf(w, "  %s [%s];\n", strconv.Quote(n.Name), attrs)
+	}
+	for _, n := range g.Nodes {
+		for _, imp := range n.Imports {
+			fmt.Fprintf(w, "  %s -> %s;\n", strconv.Quote(n.Name), strconv.Quote(imp))
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// runGraph implements `protoc graph [--format=tree|dot|json] [protoc flags]
+// <file or ref>...`.
+func runGraph(args []string, w io.Writer) int {
+	format := "tree"
+	rest := []string{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--format=") {
+			format = strings.TrimPrefix(arg, "--format=")
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	if len(rest) == 0 || (format != "tree" && format != "dot" && format != "json") {
+		fmt.Fprintln(os.Stderr, "USAGE: protoc graph [--format=tree|dot|json] [-I=<include path>...] <file>...")
+		return exitUsage
+	}
+	out, files, err := processArgs(rest)
+	if err != nil {
+		return fail(err)
+	}
+	g := buildGraph(includePaths(out), expandDirs(files))
+	sort.SliceStable(g.Nodes, func(i, j int) bool { return g.Nodes[i].Name < g.Nodes[j].Name })
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(g)
+	case "dot":
+		g.writeDot(w)
+	default:
+		g.writeTree(w)
+	}
+	if g.problems() > 0 {
+		return exitCompile
+	}
+	return 0
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildGraph(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(f func() string) { cacheDir = f }(cacheDir)
+	cacheDir = func() string { return filepath.Join(dir, "cache") }
+
+	for name, content := range map[string]string{
+		"a/api/foo.proto":      "package api;\nimport \"api/bar.proto\";\nimport \"api/missing.proto\";\nmessage Foo {}",
+		"a/api/bar.proto":      "package api;\nimport \"common/money.proto\";\nmessage Bar { message Foo {} }",
+		"a/api/other.proto":    `package api; /* message Bar {} */ enum Foo { FOO_UNSPECIFIED = 0; }`,
+		"a/common/money.proto": `package common;`,
+		"b/common/money.proto": `package common;`,
+	} {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(file), 0755)
+		ioutil.WriteFile(file, []byte(content), 0644)
+	}
+
+	names, err := parseDefinitions(filepath.Join(dir, "a", "api", "bar.proto"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"api.Bar"}, names)
+
+	g := buildGraph([]string{filepath.Join(dir, "a"), filepath.Join(dir, "b")},
+		[]string{filepath.Join(dir, "a", "api", "foo.proto"), filepath.Join(dir, "a", "api", "other.proto")})
+	assert.Equal(t, []string{"api/foo.proto", "api/other.proto"}, g.Roots)
+	assert.Len(t, g.Nodes, 5)
+	assert.Equal(t, []string{"api/bar.proto", "api/missing.proto"}, g.nodes["api/foo.proto"].Imports)
+	assert.Equal(t, "local "+filepath.Join(dir, "a", "api", "foo.proto"), g.nodes["api/foo.proto"].Origin)
+	assert.True(t, g.nodes["api/missing.proto"].Missing)
+	assert.Equal(t, []string{"shadows " + filepath.Join(dir, "b", "common", "money.proto")}, g.nodes["common/money.proto"].Duplicates)
+	assert.Equal(t, []string{"api.Foo is also defined in api/other.proto"}, g.nodes["api/foo.proto"].Duplicates)
+	assert.Equal(t, []string{"api.Foo is also defined in api/foo.proto"}, g.nodes["api/other.proto"].Duplicates)
+	assert.Empty(t, g.nodes["api/bar.proto"].Duplicates)
+	assert.Equal(t, 4, g.problems())
+
+	var buf bytes.Buffer
+	g.writeTree(&buf)
+	assert.Contains(t, buf.String(), "├── api/bar.proto (local ")
+	assert.Contains(t, buf.String(), "│   └── common/money.proto (local ")
+	assert.Contains(t, buf.String(), "└── api/missing.proto [missing]\n")
+
+	buf.Reset()
+	g.writeDot(&buf)
+	assert.Contains(t, buf.String(), `"api/missing.proto" [label="api/missing.proto\nmissing", color=red, style=dashed];`)
+	assert.Contains(t, buf.String(), `"api/foo.proto" -> "api/bar.proto";`)
+}
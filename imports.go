@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+var (
+	protoComments = regexp.MustCompile(`(?s)//[^\n]*|/\*.*?\*/`)
+	protoImport   = regexp.MustCompile(`(?m)^\s*import\s+(?:public\s+|weak\s+)?["']([^"']+)["']\s*;`)
+	protoPackage  = regexp.MustCompile(`(?m)^\s*package\s+([A-Za-z0-9_.]+)\s*;`)
+)
+
+// parseProto returns the package name and the list of files imported by the
+// proto file.
+func parseProto(file string) (string, []string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", nil, err
+	}
+	src := protoComments.ReplaceAllString(string(b), "")
+	imports := []string{}
+	for _, m := range protoImport.FindAllStringSubmatch(src, -1) {
+		imports = append(imports, m[1])
+	}
+	pkg := ""
+	if m := protoPackage.FindStringSubmatch(src); m != nil {
+		pkg = m[1]
+	}
+	return pkg, imports, nil
+}
+
+// parseImports returns the list of files imported by the proto file.
+func parseImports(file string) ([]string, error) {
+	_, imports, err := parseProto(file)
+	return imports, err
+}
+
+// remoteIncludeRoot returns an include path for the remote proto file that
+// was downloaded from the URL into the local path. The root declared in the
+// config takes precedence over the detected one.
+func remoteIncludeRoot(url, local string) string {
+	if prefix, rest, ok := matchPrefix(cfg.Roots, url); ok {
+		base := local
+		if rest != "" {
+			base = filepath.FromSlash(strings.TrimSuffix(filepath.ToSlash(local), "/"+rest))
+		}
+		return filepath.Join(base, filepath.FromSlash(cfg.Roots[prefix]))
+	}
+	if info, err := os.Stat(local); err == nil && info.IsDir() {
+		return local
+	}
+	return includeRoot(local)
+}
+
+// includeRoot detects the include path for the proto file. The deepest
+// ancestor directory within the file's repository where all the relative
+// imports of the file can be found is used. Imports provided by the standard
+// includes or by the include bundles are ignored. If the file has no such
+// imports, the directory matching its package name is used. Otherwise, the
+// directory of the file itself is used.
+func includeRoot(file string) string {
+	dir := filepath.Dir(file)
+	pkg, imports, err := parseProto(file)
+	if err != nil {
+		return dir
+	}
+	top := repositoryRoot(dir)
+	relative := []string{}
+	for _, imp := range imports {
+		if !isRemoteImport(imp) && !isEmbeddedImport(imp) {
+			relative = append(relative, imp)
+		}
+	}
+	if len(relative) > 0 {
+		for d := dir; ; d = filepath.Dir(d) {
+			found := true
+			for _, imp := range relative {
+				if _, err := os.Stat(filepath.Join(d, filepath.FromSlash(imp))); err != nil {
+					found = false
+					break
+				}
+			}
+			if found {
+				return d
+			}
+			if d == top || filepath.Dir(d) == d {
+				break
+			}
+		}
+	}
+	if pkg != "" {
+		// Package name is often (but not always) a suffix of the directory,
+		// e.g. "payments.v1" for "proto/payments/v1/api.proto"
+		suffix := string(filepath.Separator) + filepath.Join(strings.Split(pkg, ".")...)
+		if strings.HasSuffix(dir, suffix) && len(dir)-len(suffix) >= len(top) {
+			return strings.TrimSuffix(dir, suffix)
+		}
+	}
+	return dir
+}
+
+// repositoryRoot returns the topmost directory the include root of the files
+// in the directory can be detected at: the local replacement directory, the
+// repository working tree, or the cached module or cache section.
+func repositoryRoot(dir string) string {
+	for _, replacement := range cfg.Replace {
+		if abs, err := filepath.Abs(replacement); err == nil && isSubdir(abs, dir) {
+			return abs
+		}
+	}
+	for d := dir; filepath.Dir(d) != d; d = filepath.Dir(d) {
+		for _, marker := range []string{".git", ".hg"} {
+			if _, err := os.Stat(filepath.Join(d, marker)); err == nil {
+				return d
+			}
+		}
+		if filepath.Dir(d) == cacheFile() || (isSubdir(cacheFile(), d) && strings.Contains(filepath.Base(d), "@")) {
+			// Cache root, or a Go module version directory in it
+			return d
+		}
+	}
+	return filepath.VolumeName(dir) + string(filepath.Separator)
+}
+
+// isSubdir returns true if the directory is the parent directory or any of
+// its descendants.
+func isSubdir(parent, dir string) bool {
+	return dir == parent || strings.HasPrefix(dir, parent+string(filepath.Separator))
+}
+
+// isEmbeddedImport returns true if the import is provided by the standard
+// includes or by one of the include bundles, rather than by the repository
+// of the importing file.
+func isEmbeddedImport(imp string) bool {
+	if _, err := fs.Stat(include, path.Join(includesDir, imp)); err == nil {
+		return true
+	}
+	for _, name := range bundleNames() {
+		if _, err := fs.Stat(bundles, path.Join(bundlesDir, name, imp)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isRemoteImport returns true if the import path looks like a remote
+// repository URL, i.e. its first element is a host name.
+func isRemoteImport(imp string) bool {
+	parts := strings.Split(imp, "/")
+	return len(parts) > 2 && strings.Contains(parts[0], ".") && path.Ext(parts[0]) != ".proto"
+}
+
+// includePaths returns the list of include directories from the processed
+// protoc arguments.
+func includePaths(args []string) []string {
+	dirs := []string{}
+	for _, arg := range args {
+		for _, prefix := range []string{"--proto_path=", "-I=", "-I"} {
+			if strings.HasPrefix(arg, prefix) {
+				dirs = append(dirs, strings.TrimPrefix(arg, prefix))
+				break
+			}
+		}
+	}
+	return dirs
+}
+
+// importFetcher walks the imports of the resolved proto files and downloads
+// the remote ones into the repos cache.
+type importFetcher struct {
+	includes   []string
+	visited    map[string]bool
+	downloaded map[string]string
+	roots      []string          // include paths required by the fetched imports
+	replaced   map[string]string // include roots of the replaced prefixes
+}
+
+func newImportFetcher(includes []string) *importFetcher {
+	return &importFetcher{includes: includes, visited: map[string]bool{}, downloaded: map[string]string{}, replaced: map[string]string{}}
+}
+
+// linkReplaced links the local replacement of the prefix into a separate
+// include root once, so that the import paths could be resolved by protoc,
+// and returns the include root.
+func (f *importFetcher) linkReplaced(prefix string) (string, error) {
+	if root, ok := f.replaced[prefix]; ok {
+		return root, nil
+	}
+	logInfo("Using local replacement for", prefix, "=>", cfg.Replace[prefix])
+	target, err := filepath.Abs(cfg.Replace[prefix])
+	if err != nil {
+		return "", err
+	}
+	root := cacheFile("replaced")
+	link := cacheFile("replaced", filepath.FromSlash(strings.TrimSuffix(prefix, "/")))
+	if current, err := os.Readlink(link); err != nil || current != target {
+		os.Remove(link)
+		if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+			return "", err
+		}
+		if err := linkDir(target, link); err != nil {
+			return "", err
+		}
+	}
+	f.replaced[prefix] = root
+	return root, nil
+}
+
+// linkDir creates a link to the target directory. Creating symlinks requires
+// a privilege on Windows, so a directory junction is created there instead.
+func linkDir(target, link string) error {
+	if runtime.GOOS == "windows" {
+		if out, err := exec.Command("cmd", "/c", "mklink", "/J", link, target).CombinedOutput(); err != nil {
+			return fmt.Errorf("mklink %s: %w: %s", link, err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	return os.Symlink(target, link)
+}
+
+// find looks for an imported file in the importing file directory and in the
+// include paths.
+func (f *importFetcher) find(dir, imp string) string {
+	for _, d := range append([]string{dir}, f.includes...) {
+		p := filepath.Join(d, filepath.FromSlash(imp))
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			return p
+		}
+	}
+	return ""
+}
+
+// download fetches the remote import using the pinned revision from the
+// config, if any. Already cached files without a pinned revision are used as
+// is.
+func (f *importFetcher) download(from, imp string) (string, error) {
+	rev := cfg.revision(imp)
+	ref := imp
+	if rev != "" {
+		ref = imp + "@" + rev
+	}
+	if local, ok := f.downloaded[ref]; ok {
+		return local, nil
+	}
+	local := cacheFile("repos", filepath.FromSlash(imp))
+	root := ""
+	if prefix, _, ok := matchPrefix(cfg.Replace, imp); ok {
+		var err error
+		if root, err = f.linkReplaced(prefix); err != nil {
+			return "", err
+		}
+		local = cacheFile("replaced", filepath.FromSlash(imp))
+	} else {
+		if _, err := os.Stat(local); err != nil || rev != "" {
+			logInfo("Fetching remote import", ref, "from", from)
+			if local, err = downloadProto(ref); err != nil {
+				return "", err
+			}
+		}
+		root = filepath.FromSlash(strings.TrimSuffix(filepath.ToSlash(local), "/"+imp))
+	}
+	f.downloaded[ref] = local
+	for _, r := range f.roots {
+		if r == root {
+			return local, nil
+		}
+	}
+	f.roots = append(f.roots, root)
+	f.includes = append(f.includes, root)
+	return local, nil
+}
+
+// fetch resolves imports of the file recursively. Imported files that can not
+// be found locally and look like remote URLs are downloaded.
+func (f *importFetcher) fetch(file string) error {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	if f.visited[file] {
+		return nil
+	}
+	f.visited[file] = true
+	imports, err := parseImports(file)
+	if err != nil {
+		// Let protoc report missing or unreadable files
+		return nil
+	}
+	for _, imp := range imports {
+		local := f.find(filepath.Dir(file), imp)
+		if local == "" && isRemoteImport(imp) {
+			if local, err = f.download(file, imp); err != nil {
+				return err
+			}
+		}
+		if local != "" {
+			if err := f.fetch(local); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
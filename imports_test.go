@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "foo.proto")
+	ioutil.WriteFile(file, []byte(`syntax = "proto3";
+import "google/protobuf/empty.proto";
+import public "github.com/org/common/money.proto";
+// import "github.com/org/commented/out.proto";
+/* import "github.com/org/commented/block.proto"; */
+  import weak 'bar.proto' ;
+`), 0644)
+	imports, err := parseImports(file)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"google/protobuf/empty.proto", "github.com/org/common/money.proto", "bar.proto"}, imports)
+
+	assert.False(t, isRemoteImport("google/protobuf/empty.proto"))
+	assert.False(t, isRemoteImport("bar.proto"))
+	assert.False(t, isRemoteImport("foo.proto/bar.proto"))
+	assert.True(t, isRemoteImport("github.com/org/common/money.proto"))
+}
+
+func TestFetchReplacedImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(f func() string) { cacheDir = f }(cacheDir)
+	cacheDir = func() string { return filepath.Join(dir, "cache") }
+	defer func(c *config) { cfg = c }(cfg)
+	cfg = &config{Replace: map[string]string{"github.com/org/common": filepath.Join(dir, "common")}}
+
+	os.MkdirAll(filepath.Join(dir, "common"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "foo.proto"), []byte(`import "github.com/org/common/money.proto";`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "common", "money.proto"), []byte(`import "github.com/org/common/currency.proto";`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "common", "currency.proto"), []byte(`import "github.com/org/common/money.proto";`), 0644)
+
+	f := newImportFetcher(nil)
+	assert.NoError(t, f.fetch(filepath.Join(dir, "foo.proto")))
+	assert.Equal(t, []string{cacheFile("replaced")}, f.roots)
+	assert.Len(t, f.visited, 3)
+	_, err = os.Stat(filepath.Join(cacheFile("replaced"), "github.com", "org", "common", "currency.proto"))
+	assert.NoError(t, err)
+
+	// The link is created once and reused by the later invocations
+	link := cacheFile("replaced", "github.com", "org", "common")
+	before, err := os.Lstat(link)
+	assert.NoError(t, err)
+	f = newImportFetcher(nil)
+	assert.NoError(t, f.fetch(filepath.Join(dir, "foo.proto")))
+	after, err := os.Lstat(link)
+	assert.NoError(t, err)
+	assert.True(t, os.SameFile(before, after))
+}
+
+func TestIncludeRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(c *config) { cfg = c }(cfg)
+	cfg = &config{}
+
+	v1 := filepath.Join(dir, "repo", "proto", "payments", "v1")
+	os.MkdirAll(v1, 0755)
+	ioutil.WriteFile(filepath.Join(v1, "api.proto"), []byte(`package payments.v1;
+import "payments/v1/types.proto";
+import "google/protobuf/empty.proto";`), 0644)
+	ioutil.WriteFile(filepath.Join(v1, "types.proto"), []byte(`package payments.v1;`), 0644)
+	ioutil.WriteFile(filepath.Join(v1, "other.proto"), []byte(`package other;`), 0644)
+
+	assert.Equal(t, filepath.Join(dir, "repo", "proto"), includeRoot(filepath.Join(v1, "api.proto")))
+	assert.Equal(t, filepath.Join(dir, "repo", "proto"), includeRoot(filepath.Join(v1, "types.proto")))
+	assert.Equal(t, v1, includeRoot(filepath.Join(v1, "other.proto")))
+
+	// Imports from the bundles don't affect the root, and the walk stops at
+	// the repository root even if a matching directory is found above it
+	ioutil.WriteFile(filepath.Join(v1, "annotated.proto"), []byte(`package payments.v1;
+import "google/api/annotations.proto";
+import "payments/v1/types.proto";`), 0644)
+	assert.Equal(t, filepath.Join(dir, "repo", "proto"), includeRoot(filepath.Join(v1, "annotated.proto")))
+	os.MkdirAll(filepath.Join(dir, "repo", ".git"), 0755)
+	os.MkdirAll(filepath.Join(dir, "shared"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "shared", "common.proto"), []byte(`package shared;`), 0644)
+	ioutil.WriteFile(filepath.Join(v1, "shared.proto"), []byte(`package other;
+import "shared/common.proto";`), 0644)
+	assert.Equal(t, v1, includeRoot(filepath.Join(v1, "shared.proto")))
+
+	cfg = &config{Roots: map[string]string{"github.com/org/repo": "proto/payments"}}
+	assert.Equal(t, filepath.Join(dir, "repo", "proto", "payments"),
+		remoteIncludeRoot("github.com/org/repo/proto/payments/v1/other.proto", filepath.Join(v1, "other.proto")))
+}
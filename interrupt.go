@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// runCtx is the context of the current wrapper invocation. It is canceled
+// when the wrapper receives SIGINT or SIGTERM, or when the timeout expires,
+// which stops the resolution and the running protoc.
+var runCtx = context.Background()
+
+// interrupt holds the signal received by the wrapper, which is forwarded to
+// the running protoc.
+var interrupt atomic.Value
+
+// setupContext returns the wrapper context with the timeout from the
+// PROTOC_TIMEOUT environment variable, overridden by the wrapper-specific
+// --timeout=DURATION flag, e.g. "--timeout=5m". The flags are removed from
+// the returned arguments.
+func setupContext(args []string) (context.Context, context.CancelFunc, []string, error) {
+	timeout := os.Getenv("PROTOC_TIMEOUT")
+	out := []string{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--timeout=") {
+			timeout = strings.TrimPrefix(arg, "--timeout=")
+		} else {
+			out = append(out, arg)
+		}
+	}
+	var d time.Duration
+	if timeout != "" {
+		var err error
+		if d, err = time.ParseDuration(timeout); err != nil || d < 0 {
+			return nil, nil, nil, fmt.Errorf("invalid timeout: %s", timeout)
+		}
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if d > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), d)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigs:
+			interrupt.Store(sig)
+			logWarn("Received", sig.String()+", stopping")
+			cancel()
+		case <-ctx.Done():
+		}
+		// Another signal terminates the wrapper immediately
+		signal.Stop(sigs)
+	}()
+	return ctx, cancel, out, nil
+}
+
+// terminateGracePeriod is the time the process has to exit after the signal
+// before it is killed.
+var terminateGracePeriod = 5 * time.Second
+
+// terminate forwards the received signal to the process, or sends SIGTERM if
+// the timeout has expired. The process is killed if it is still running after
+// the grace period, or if signals are not supported, e.g. on Windows.
+func terminate(p *os.Process, done <-chan struct{}) {
+	sig, ok := interrupt.Load().(os.Signal)
+	if !ok {
+		logError("Timeout expired, stopping protoc")
+		sig = syscall.SIGTERM
+	}
+	if err := p.Signal(sig); err != nil {
+		p.Kill()
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(terminateGracePeriod):
+		logError("Protoc did not stop in", terminateGracePeriod, "killing it")
+		p.Kill()
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetupContext(t *testing.T) {
+	defer os.Unsetenv("PROTOC_TIMEOUT")
+
+	ctx, cancel, args, err := setupContext([]string{"-I=.", "foo.proto"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-I=.", "foo.proto"}, args)
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+	cancel()
+
+	os.Setenv("PROTOC_TIMEOUT", "1h")
+	ctx, cancel, args, err = setupContext([]string{"--timeout=1m", "foo.proto"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo.proto"}, args)
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, 10*time.Second)
+	cancel()
+
+	_, _, _, err = setupContext([]string{"--timeout=soon"})
+	assert.Error(t, err)
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sleep")
+	}
+	defer func(ctx context.Context) { runCtx = ctx }(runCtx)
+	ctx, cancel, _, err := setupContext([]string{"--timeout=100ms"})
+	assert.NoError(t, err)
+	defer cancel()
+	runCtx = ctx
+
+	start := time.Now()
+	_, exitCode := execute("sleep", "10")
+	assert.NotEqual(t, 0, exitCode)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// Nothing is started once the context is done
+	_, exitCode = execute("true")
+	assert.Equal(t, exitTimeout, exitCode)
+}
+
+func TestExecuteKill(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	defer func(ctx context.Context) { runCtx = ctx }(runCtx)
+	defer func(d time.Duration) { terminateGracePeriod = d }(terminateGracePeriod)
+	terminateGracePeriod = 100 * time.Millisecond
+	ctx, cancel, _, err := setupContext([]string{"--timeout=100ms"})
+	assert.NoError(t, err)
+	defer cancel()
+	runCtx = ctx
+
+	// The process ignoring SIGTERM is killed after the grace period
+	start := time.Now()
+	_, exitCode := execute("sh", "-c", `trap "" TERM; exec sleep 10`)
+	assert.Equal(t, 128+int(syscall.SIGKILL), exitCode)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// lintRule is a single style or safety check of the lint command.
+type lintRule struct {
+	id   string
+	desc string
+}
+
+var lintRules = []lintRule{
+	{id: "PACKAGE_DIRECTORY_MATCH", desc: "package name matches the file directory"},
+	{id: "MESSAGE_PASCAL_CASE", desc: "message names are PascalCase"},
+	{id: "FIELD_LOWER_SNAKE_CASE", desc: "field names are lower_snake_case"},
+	{id: "ENUM_PASCAL_CASE", desc: "enum names are PascalCase"},
+	{id: "ENUM_VALUE_UPPER_SNAKE_CASE", desc: "enum value names are UPPER_SNAKE_CASE"},
+	{id: "ENUM_ZERO_VALUE_UNSPECIFIED", desc: "enum zero value is named <ENUM>_UNSPECIFIED"},
+	{id: "SERVICE_PASCAL_CASE", desc: "service names are PascalCase"},
+	{id: "RPC_PASCAL_CASE", desc: "RPC names are PascalCase"},
+	{id: "FIELD_NUMBERS_RESERVED", desc: "numbers of removed fields are reserved"},
+	{id: "GO_PACKAGE_DEFINED", desc: "go_package option is defined"},
+	{id: "JAVA_PACKAGE_DEFINED", desc: "java_package option is defined"},
+	{id: "COMMENTS", desc: "messages, enums, services and RPCs have leading comments"},
+}
+
+// lintConfig enables or disables individual lint rules. All rules are enabled
+// by default.
+type lintConfig struct {
+	Enable  []string `json:"enable,omitempty"`
+	Disable []string `json:"disable,omitempty"`
+}
+
+func (c lintConfig) enabled() (map[string]bool, error) {
+	rules := map[string]bool{}
+	for _, r := range lintRules {
+		rules[r.id] = len(c.Enable) == 0
+	}
+	for _, ids := range []struct {
+		list  []string
+		value bool
+	}{{c.Enable, true}, {c.Disable, false}} {
+		for _, id := range ids.list {
+			if _, ok := rules[id]; !ok {
+				return nil, fmt.Errorf("unknown lint rule: %s", id)
+			}
+			rules[id] = ids.value
+		}
+	}
+	return rules, nil
+}
+
+// lintIssue is a single rule violation.
+type lintIssue struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (i lintIssue) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s", i.File, i.Line, i.Column, i.Rule, i.Message)
+}
+
+var (
+	pascalCase     = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+	lowerSnakeCase = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+	upperSnakeCase = regexp.MustCompile(`^[A-Z][A-Z0-9]*(_[A-Z0-9]+)*$`)
+)
+
+// Field numbers of the descriptor messages, used to build source code info
+// paths.
+const (
+	fileMessageTag   = 4
+	fileEnumTag      = 5
+	fileServiceTag   = 6
+	messageFieldTag  = 2
+	messageNestedTag = 3
+	messageEnumTag   = 4
+	enumValueTag     = 2
+	serviceMethodTag = 2
+	filePackageTag   = 2
+	fileSyntaxTag    = 12
+)
+
+type linter struct {
+	rules    map[string]bool
+	issues   []lintIssue
+	file     *descriptorpb.FileDescriptorProto
+	comments map[string]*descriptorpb.SourceCodeInfo_Location
+}
+
+func pathKey(p []int32) string {
+	return fmt.Sprint(p)
+}
+
+func (l *linter) report(rule string, p []int32, format string, args ...interface{}) {
+	if !l.rules[rule] {
+		return
+	}
+	issue := lintIssue{File: l.file.GetName(), Line: 1, Column: 1, Rule: rule, Message: fmt.Sprintf(format, args...)}
+	// Use the location of the closest enclosing element if there is no exact one
+	for len(p) > 0 {
+		if loc, ok := l.comments[pathKey(p)]; ok && len(loc.Span) >= 2 {
+			issue.Line, issue.Column = int(loc.Span[0])+1, int(loc.Span[1])+1
+			break
+		}
+		if len(p) < 2 {
+			break
+		}
+		p = p[:len(p)-2]
+	}
+	l.issues = append(l.issues, issue)
+}
+
+func (l *linter) requireComment(p []int32, kind, name string) {
+	if loc, ok := l.comments[pathKey(p)]; !ok || strings.TrimSpace(loc.GetLeadingComments()) == "" {
+		l.report("COMMENTS", p, "%s %s has no leading comment", kind, name)
+	}
+}
+
+func appendPath(p []int32, elems ...int32) []int32 {
+	return append(append([]int32{}, p...), elems...)
+}
+
+// lintDescriptors checks every file of the descriptor set against the enabled
+// rules.
+func lintDescriptors(set *descriptorpb.FileDescriptorSet, rules map[string]bool) []lintIssue {
+	l := &linter{rules: rules}
+	for _, f := range set.File {
+		l.file = f
+		l.comments = map[string]*descriptorpb.SourceCodeInfo_Location{}
+		for _, loc := range f.GetSourceCodeInfo().GetLocation() {
+			l.comments[pathKey(loc.Path)] = loc
+		}
+		dir := path.Dir(f.GetName())
+		if dir == "." {
+			dir = ""
+		}
+		if pkg := strings.ReplaceAll(f.GetPackage(), ".", "/"); pkg != dir {
+			l.report("PACKAGE_DIRECTORY_MATCH", []int32{filePackageTag}, "package %q does not match directory %q", f.GetPackage(), dir)
+		}
+		if f.GetOptions().GetGoPackage() == "" {
+			l.report("GO_PACKAGE_DEFINED", []int32{fileSyntaxTag}, "go_package option is not defined")
+		}
+		if f.GetOptions().GetJavaPackage() == "" {
+			l.report("JAVA_PACKAGE_DEFINED", []int32{fileSyntaxTag}, "java_package option is not defined")
+		}
+		for i, m := range f.MessageType {
+			l.lintMessage([]int32{fileMessageTag, int32(i)}, m)
+		}
+		for i, e := range f.EnumType {
+			l.lintEnum([]int32{fileEnumTag, int32(i)}, e)
+		}
+		for i, s := range f.Service {
+			p := []int32{fileServiceTag, int32(i)}
+			if !pascalCase.MatchString(s.GetName()) {
+				l.report("SERVICE_PASCAL_CASE", p, "service name %q is not PascalCase", s.GetName())
+			}
+			l.requireComment(p, "service", s.GetName())
+			for j, m := range s.Method {
+				mp := appendPath(p, serviceMethodTag, int32(j))
+				if !pascalCase.MatchString(m.GetName()) {
+					l.report("RPC_PASCAL_CASE", mp, "RPC name %q is not PascalCase", m.GetName())
+				}
+				l.requireComment(mp, "RPC", m.GetName())
+			}
+		}
+	}
+	sort.SliceStable(l.issues, func(i, j int) bool {
+		a, b := l.issues[i], l.issues[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return l.issues
+}
+
+func (l *linter) lintMessage(p []int32, m *descriptorpb.DescriptorProto) {
+	if m.GetOptions().GetMapEntry() {
+		return
+	}
+	if !pascalCase.MatchString(m.GetName()) {
+		l.report("MESSAGE_PASCAL_CASE", p, "message name %q is not PascalCase", m.GetName())
+	}
+	l.requireComment(p, "message", m.GetName())
+	used := []numberRange{}
+	for i, f := range m.Field {
+		if !lowerSnakeCase.MatchString(f.GetName()) {
+			l.report("FIELD_LOWER_SNAKE_CASE", appendPath(p, messageFieldTag, int32(i)), "field name %q is not lower_snake_case", f.GetName())
+		}
+		used = append(used, numberRange{f.GetNumber(), f.GetNumber() + 1})
+	}
+	for _, r := range m.ReservedRange {
+		used = append(used, numberRange{r.GetStart(), r.GetEnd()})
+	}
+	for _, r := range m.ExtensionRange {
+		used = append(used, numberRange{r.GetStart(), r.GetEnd()})
+	}
+	missing := []string{}
+	for _, gap := range numberGaps(used) {
+		// Larger gaps are usually deliberate, e.g. grouping fields by
+		// hundreds, rather than removed fields
+		if gap.end-gap.start <= maxFieldNumberGap {
+			missing = append(missing, gap.String())
+		}
+	}
+	if len(missing) > 0 {
+		l.report("FIELD_NUMBERS_RESERVED", p, "message %s has unused field numbers that are not reserved: %s", m.GetName(), strings.Join(missing, ", "))
+	}
+	for i, nested := range m.NestedType {
+		l.lintMessage(appendPath(p, messageNestedTag, int32(i)), nested)
+	}
+	for i, e := range m.EnumType {
+		l.lintEnum(appendPath(p, messageEnumTag, int32(i)), e)
+	}
+}
+
+// maxFieldNumberGap is the largest number of consecutive unused field numbers
+// reported by the FIELD_NUMBERS_RESERVED rule.
+const maxFieldNumberGap = 4
+
+// numberRange is a half-open range of field numbers.
+type numberRange struct {
+	start, end int32
+}
+
+func (r numberRange) String() string {
+	if r.end-r.start == 1 {
+		return fmt.Sprint(r.start)
+	}
+	return fmt.Sprintf("%d-%d", r.start, r.end-1)
+}
+
+// numberGaps returns the ranges of unused numbers between 1 and the largest
+// used number.
+func numberGaps(used []numberRange) []numberRange {
+	sort.Slice(used, func(i, j int) bool { return used[i].start < used[j].start })
+	gaps := []numberRange{}
+	next := int32(1)
+	for _, r := range used {
+		if r.start > next {
+			gaps = append(gaps, numberRange{next, r.start})
+		}
+		if r.end > next {
+			next = r.end
+		}
+	}
+	return gaps
+}
+
+func (l *linter) lintEnum(p []int32, e *descriptorpb.EnumDescriptorProto) {
+	if !pascalCase.MatchString(e.GetName()) {
+		l.report("ENUM_PASCAL_CASE", p, "enum name %q is not PascalCase", e.GetName())
+	}
+	l.requireComment(p, "enum", e.GetName())
+	for i, v := range e.Value {
+		if !upperSnakeCase.MatchString(v.GetName()) {
+			l.report("ENUM_VALUE_UPPER_SNAKE_CASE", appendPath(p, enumValueTag, int32(i)), "enum value name %q is not UPPER_SNAKE_CASE", v.GetName())
+		}
+	}
+	if len(e.Value) > 0 {
+		zero := e.Value[0]
+		expected := toUpperSnakeCase(e.GetName()) + "_UNSPECIFIED"
+		if zero.GetNumber() != 0 || zero.GetName() != expected {
+			l.report("ENUM_ZERO_VALUE_UNSPECIFIED", appendPath(p, enumValueTag, 0), "enum %s zero value should be %s = 0", e.GetName(), expected)
+		}
+	}
+}
+
+func toUpperSnakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if r >= 'A' && r <= 'Z' && i > 0 {
+			b.WriteByte('_')
+		}
+		b.WriteRune(r)
+	}
+	return strings.ToUpper(b.String())
+}
+
+// runLint implements `protoc lint [--format=text|json] [--enable=RULE,...]
+// [--disable=RULE,...] <file or ref>...`.
+func runLint(protocExePath string, args []string, w io.Writer) int {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	lc := cfg.Lint
+	format := fs.String("format", "text", "output format: text or json")
+	enable := fs.String("enable", strings.Join(lc.Enable, ","), "comma-separated list of enabled rules, all by default")
+	disable := fs.String("disable", strings.Join(lc.Disable, ","), "comma-separated list of disabled rules")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 || (*format != "text" && *format != "json") {
+		fmt.Fprintln(os.Stderr, "USAGE: protoc lint [--format=text|json] [--enable=RULE,...] [--disable=RULE,...] <file>...")
+		fmt.Fprintln(os.Stderr, "Rules:")
+		for _, r := range lintRules {
+			fmt.Fprintf(os.Stderr, "  %-28s %s\n", r.id, r.desc)
+		}
+		return exitUsage
+	}
+	lc.Enable, lc.Disable = nil, nil
+	if *enable != "" {
+		lc.Enable = strings.Split(*enable, ",")
+	}
+	if *disable != "" {
+		lc.Disable = strings.Split(*disable, ",")
+	}
+	rules, err := lc.enabled()
+	if err != nil {
+		logError(err)
+		return exitUsage
+	}
+	set, err := compileDescriptors(protocExePath, fs.Args(), true)
+	if err != nil {
+		return fail(err)
+	}
+	issues := lintDescriptors(set, rules)
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if issues == nil {
+			issues = []lintIssue{}
+		}
+		enc.Encode(issues)
+	} else {
+		for _, issue := range issues {
+			fmt.Fprintln(w, issue)
+		}
+	}
+	if len(issues) > 0 {
+		return exitCompile
+	}
+	return 0
+}
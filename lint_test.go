@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestLintDescriptors(t *testing.T) {
+	set := testDescriptors()
+	f := set.File[0]
+	f.Options = &descriptorpb.FileOptions{GoPackage: proto.String("example.com/payments/v1")}
+	msg := f.MessageType[0]
+	msg.Field[0].Name = proto.String("paymentId")
+	msg.Field[3].Number = proto.Int32(7)
+	msg.ReservedRange = []*descriptorpb.DescriptorProto_ReservedRange{{Start: proto.Int32(5), End: proto.Int32(6)}}
+	f.EnumType[0].Value[0].Name = proto.String("UNKNOWN")
+	f.SourceCodeInfo = &descriptorpb.SourceCodeInfo{Location: []*descriptorpb.SourceCodeInfo_Location{
+		{Path: []int32{4, 0}, Span: []int32{5, 0, 10, 1}, LeadingComments: proto.String(" Payment.\n")},
+		{Path: []int32{4, 0, 2, 0}, Span: []int32{6, 2, 20}},
+		{Path: []int32{4, 0, 3, 0}, Span: []int32{11, 2, 20}, LeadingComments: proto.String(" Meta.\n")},
+		{Path: []int32{5, 0}, Span: []int32{13, 0, 16, 1}, LeadingComments: proto.String(" Status.\n")},
+		{Path: []int32{6, 0}, Span: []int32{18, 0, 21, 1}, LeadingComments: proto.String(" Payments.\n")},
+		{Path: []int32{6, 0, 2, 0}, Span: []int32{19, 2, 40}, LeadingComments: proto.String(" Get.\n")},
+		{Path: []int32{6, 0, 2, 1}, Span: []int32{20, 2, 40}},
+	}}
+
+	rules, err := lintConfig{}.enabled()
+	assert.NoError(t, err)
+	issues := []string{}
+	for _, issue := range lintDescriptors(set, rules) {
+		issues = append(issues, issue.String())
+	}
+	assert.Equal(t, []string{
+		"payments/v1/api.proto:1:1: JAVA_PACKAGE_DEFINED: java_package option is not defined",
+		"payments/v1/api.proto:6:1: FIELD_NUMBERS_RESERVED: message Payment has unused field numbers that are not reserved: 4, 6",
+		"payments/v1/api.proto:7:3: FIELD_LOWER_SNAKE_CASE: field name \"paymentId\" is not lower_snake_case",
+		"payments/v1/api.proto:14:1: ENUM_ZERO_VALUE_UNSPECIFIED: enum Status zero value should be STATUS_UNSPECIFIED = 0",
+		"payments/v1/api.proto:21:3: COMMENTS: RPC Delete has no leading comment",
+	}, issues)
+
+	rules, err = lintConfig{Enable: []string{"PACKAGE_DIRECTORY_MATCH", "COMMENTS"}, Disable: []string{"COMMENTS"}}.enabled()
+	assert.NoError(t, err)
+	f.Package = proto.String("payments.v2")
+	issues = []string{}
+	for _, issue := range lintDescriptors(set, rules) {
+		issues = append(issues, issue.Rule)
+	}
+	assert.Equal(t, []string{"PACKAGE_DIRECTORY_MATCH"}, issues)
+
+	_, err = lintConfig{Disable: []string{"UNKNOWN"}}.enabled()
+	assert.Error(t, err)
+}
+
+func TestNumberGaps(t *testing.T) {
+	gaps := numberGaps([]numberRange{{3, 4}, {536870911, 536870912}, {1, 2}, {5, 10}, {8, 12}, {100, 101}})
+	assert.Equal(t, []numberRange{{2, 3}, {4, 5}, {12, 100}, {101, 536870911}}, gaps)
+	assert.Equal(t, "2", gaps[0].String())
+	assert.Equal(t, "12-99", gaps[2].String())
+}
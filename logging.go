@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// logLevel is the severity of the wrapper messages. Messages below the
+// configured level are not printed.
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l logLevel) String() string {
+	return levelNames[l]
+}
+
+func parseLogLevel(s string) (logLevel, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return logLevel(i), nil
+		}
+	}
+	return levelInfo, fmt.Errorf("unknown log level: %s", s)
+}
+
+var (
+	minLogLevel = levelInfo
+	jsonLogs    = false
+)
+
+// setupLogging configures the log level and format from PROTOC_LOG_LEVEL and
+// PROTOC_LOG_FORMAT environment variables, overridden by the wrapper-specific
+// -q, -v and --log-format=text|json flags. The flags are removed from the
+// returned arguments.
+func setupLogging(args []string) ([]string, error) {
+	if s := os.Getenv("PROTOC_LOG_LEVEL"); s != "" {
+		level, err := parseLogLevel(s)
+		if err != nil {
+			return nil, err
+		}
+		minLogLevel = level
+	}
+	format := os.Getenv("PROTOC_LOG_FORMAT")
+	out := []string{}
+	for _, arg := range args {
+		switch {
+		case arg == "-q":
+			minLogLevel = levelWarn
+		case arg == "-v":
+			minLogLevel = levelDebug
+		case strings.HasPrefix(arg, "--log-format="):
+			format = strings.TrimPrefix(arg, "--log-format=")
+		default:
+			out = append(out, arg)
+		}
+	}
+	switch format {
+	case "", "text":
+		jsonLogs = false
+	case "json":
+		jsonLogs = true
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", format)
+	}
+	return out, nil
+}
+
+// logEntry is a single message in the JSON log format.
+type logEntry struct {
+	Time  string `json:"time"`
+	Level string `json:"level"`
+	Msg   string `json:"msg"`
+}
+
+func logAt(level logLevel, v ...interface{}) {
+	if level < minLogLevel {
+		return
+	}
+	msg := strings.TrimSuffix(fmt.Sprintln(v...), "\n")
+	if !jsonLogs {
+		log.Print(msg)
+		return
+	}
+	b, _ := json.Marshal(logEntry{Time: time.Now().Format(time.RFC3339), Level: level.String(), Msg: msg})
+	log.Writer().Write(append(b, '\n'))
+}
+
+func logDebug(v ...interface{}) { logAt(levelDebug, v...) }
+func logInfo(v ...interface{})  { logAt(levelInfo, v...) }
+func logWarn(v ...interface{})  { logAt(levelWarn, v...) }
+func logError(v ...interface{}) { logAt(levelError, v...) }
+
+// wrapperLogger passes the messages of the resolver library to the wrapper
+// log.
+type wrapperLogger struct{}
+
+func (wrapperLogger) Debug(v ...interface{}) { logDebug(v...) }
+func (wrapperLogger) Info(v ...interface{})  { logInfo(v...) }
+func (wrapperLogger) Warn(v ...interface{})  { logWarn(v...) }
+func (wrapperLogger) Error(v ...interface{}) { logError(v...) }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogging(t *testing.T) {
+	defer func(level logLevel, j bool) { minLogLevel, jsonLogs = level, j }(minLogLevel, jsonLogs)
+	defer log.SetOutput(os.Stderr)
+	defer os.Unsetenv("PROTOC_LOG_LEVEL")
+
+	os.Setenv("PROTOC_LOG_LEVEL", "warn")
+	args, err := setupLogging([]string{"-I=.", "foo.proto"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-I=.", "foo.proto"}, args)
+	assert.Equal(t, levelWarn, minLogLevel)
+
+	args, err = setupLogging([]string{"-v", "--log-format=json", "foo.proto"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo.proto"}, args)
+	assert.Equal(t, levelDebug, minLogLevel)
+	assert.True(t, jsonLogs)
+
+	_, err = setupLogging([]string{"--log-format=xml"})
+	assert.Error(t, err)
+	os.Setenv("PROTOC_LOG_LEVEL", "loud")
+	_, err = setupLogging(nil)
+	assert.Error(t, err)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	minLogLevel = levelInfo
+	logDebug("hidden")
+	logInfo("Downloading", "foo")
+	var entry logEntry
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "info", entry.Level)
+	assert.Equal(t, "Downloading foo", entry.Msg)
+
+	buf.Reset()
+	jsonLogs = false
+	minLogLevel = levelWarn
+	logInfo("hidden")
+	logError("git:", "fatal: not found")
+	assert.Contains(t, buf.String(), "git: fatal: not found\n")
+	assert.NotContains(t, buf.String(), "hidden")
+}
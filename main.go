@@ -2,233 +2,294 @@ package main
 
 import (
 	"bytes"
-	"crypto/md5"
 	"embed"
-	"errors"
 	"fmt"
 	"io"
-	"io/fs"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
 	"os/exec"
-	"path"
 	"path/filepath"
-	"regexp"
-	"runtime"
 	"strings"
 	"syscall"
+
+	"github.com/sixt/protoc/v3/resolver"
 )
 
 //go:generate go run -tags generate gen.go 22.2
 
-// Keep this version in sync with the go:generate statement above
+// Keep resolver.ProtocVersion in sync with the go:generate statement above
 const (
-	version                     = "3.22.2"
-	protoBinariesBaseURL        = "https://repo1.maven.org/maven2/com/google/protobuf/protoc"
+	version                     = resolver.ProtocVersion
 	includesDir                 = "include"
 	includesCacheFilePermission = 0664
 	includesCacheDirPermission  = 0775
 )
 
-var platforms = map[string]string{
-	"linux_386":     "linux-x86_32",
-	"linux_amd64":   "linux-x86_64",
-	"linux_arm64":   "linux-aarch_64",
-	"darwin_amd64":  "osx-x86_64",
-	"darwin_arm64":  "osx-aarch_64",
-	"windows_386":   "windows-x86_32",
-	"windows_amd64": "windows-x86_64",
-}
-
 //go:embed include/google/protobuf
 var include embed.FS
 
-type repo interface {
-	Checkout(rev string) error
-	Fetch() error
+// downloadProto resolves the remote reference and returns its local path.
+func downloadProto(ref string) (string, error) {
+	_, local, err := downloadSource(ref)
+	return local, err
 }
 
-const latestRev = "latest"
-
-func openRepo(url string) (repo, string, string, error) {
-	parts := strings.Split(url, "/")
-	for i := len(parts); i > 0; i-- {
-		dir := cacheFile("repos", filepath.Join(parts[:i]...))
-		// Sometimes go-git gives false positives, check for .git directory before PlainOpen()
-		if info, err := os.Stat(filepath.Join(dir, ".git")); err != nil || !info.IsDir() {
-			continue
-		}
-		repoURL := path.Join(parts[:i]...)
-		repo, err := gitOpenDir(repoURL, dir)
-		if err == nil {
-			log.Println("Use cached repository:", dir)
-			return repo, dir, filepath.Join(dir, filepath.Join(parts[i:]...)), nil
-		}
+// pinRevision adds the revision pinned in the config to the remote reference
+// without an explicit revision.
+func pinRevision(ref string) string {
+	if url, rev := resolver.SplitRev(ref); rev == "" && cfg.revision(url) != "" {
+		return url + "@" + cfg.revision(url)
 	}
-	return nil, "", "", errors.New("failed to open " + url)
+	return ref
 }
 
-func cloneRepo(url string) (repo, string, error) {
-	for _, vcsPath := range []string{
-		`^(github\.com/[A-Za-z0-9_.\-]+/[A-Za-z0-9_.\-]+)((/[\p{L}0-9_.\-]+)*)$`,
-		`^(bitbucket\.org/[A-Za-z0-9_.\-]+/[A-Za-z0-9_.\-]+)((/[A-Za-z0-9_.\-]+)*)$`,
-	} {
-		re := regexp.MustCompile(vcsPath)
-		if m := re.FindStringSubmatch(url); m != nil {
-			if repo, dir, err := tryCloneRepo(m[1]); err == nil {
-				return repo, filepath.Join(dir, m[2]), nil
-			} else {
-				return nil, "", err
-			}
-		}
-	}
-	parts := strings.Split(url, "/")
-	for i := 1; i <= len(parts); i++ {
-		repoURL := path.Join(parts[:i]...)
-		if repo, dir, err := tryCloneRepo(repoURL); err == nil {
-			return repo, filepath.Join(dir, filepath.Join(parts[i:]...)), nil
-		}
+// isRemoteRef returns true if the reference is a URL, or starts with a host
+// name, e.g. "github.com/org/repo" or "127.0.0.1:8080/repo".
+func isRemoteRef(ref string) bool {
+	url, _ := resolver.SplitRev(ref)
+	if strings.Contains(url, "://") || isRemoteImport(url) {
+		return true
 	}
-	return nil, "", errors.New("clone failed: " + url)
+	parts := strings.SplitN(url, "/", 2)
+	return len(parts) == 2 && len(parts[0]) > 2 && strings.Contains(parts[0], ":")
 }
 
-func tryCloneRepo(repoURL string) (repo, string, error) {
-	dir := cacheFile("repos", repoURL)
-	os.MkdirAll(dir, 0755)
-	log.Println("Trying to clone", repoURL, "into", dir)
-	repo, cloneErr := gitCloneDir(repoURL, dir)
-	if cloneErr == nil {
-		log.Println("Cloned repository:", dir, repoURL)
-		return repo, dir, nil
-	}
-	if gitInfo, err := os.Stat(filepath.Join(dir, ".git")); err == nil && gitInfo.IsDir() {
-		os.RemoveAll(dir)
-	}
-	return nil, "", cloneErr
+// resolvePath returns a local path for a file used by a protoc flag, such as
+// a descriptor set, a plugin or a response file, and the reference it was
+// resolved from, including the pinned revision. Existing local paths are
+// returned as is, remote references are downloaded into the cache.
+func resolvePath(ref string) (string, string, error) {
+	if _, err := os.Stat(ref); err == nil {
+		return ref, ref, nil
+	}
+	if !isRemoteRef(ref) {
+		// Let protoc report missing files
+		return ref, ref, nil
+	}
+	ref = pinRevision(ref)
+	local, err := downloadProto(ref)
+	return local, ref, err
 }
 
-func downloadProto(url string) (string, error) {
-	url = path.Clean(url)
-	rev := ""
-	if i := strings.LastIndex(url, "@"); i >= 0 {
-		rev = url[i+1:]
-		url = url[:i]
-	}
-	repo, dir, local, err := openRepo(url)
-	if err == nil && rev == latestRev {
-		log.Println("Invalidate cached directory:", dir)
-		os.RemoveAll(dir)
-	}
-	if err != nil || rev == latestRev {
-		repo, local, err = cloneRepo(url)
-	}
-	if err != nil {
-		return "", err
-	}
-	err = repo.Checkout(rev)
-	if err != nil {
-		if err = repo.Fetch(); err != nil {
-			log.Println("fetch failed:", err)
+// splitPathList splits a list of paths separated by the OS path list
+// separator, keeping the URL schemes attached to their URLs.
+func splitPathList(list string) []string {
+	paths := []string{}
+	for _, p := range filepath.SplitList(list) {
+		if n := len(paths); n > 0 && (paths[n-1] == "http" || paths[n-1] == "https") && strings.HasPrefix(p, "//") {
+			paths[n-1] = paths[n-1] + ":" + p
 		} else {
-			err = repo.Checkout(rev)
+			paths = append(paths, p)
 		}
 	}
-	return local, err
+	return paths
 }
 
+// force disables skipping protoc invocations with unchanged inputs.
+var force bool
+
+// check enables check mode, where the generated code is compared with the
+// files in the working tree instead of overwriting them.
+var check bool
+
 // processArgs converts protoc command line arguments by replacing remote
 // repository URLs with local paths.
 func processArgs(in []string) ([]string, []string, error) {
+	out, files, _, err := resolveArgs(in)
+	return out, files, err
+}
+
+// resolveArgs is processArgs that also explains how every argument and remote
+// import was resolved.
+func resolveArgs(in []string) ([]string, []string, []resolvedArg, error) {
 	var out []string
 	var files []string
-	for n, arg := range in {
-		if arg == "--version" {
-			fmt.Println("protoc wrapper " + version)
+	var steps []resolvedArg
+	bundleNames := append([]string{}, cfg.Bundles...)
+	parsed, err := parseProtocArgs(in)
+	if err != nil {
+		return nil, nil, nil, &usageError{err}
+	}
+	for _, a := range parsed {
+		arg := a.value
+		if a.flag == "--check" || a.flag == "--force" || a.flag == "--bundle" || a.flag == "--resolve-only" {
+			steps = append(steps, resolvedArg{Arg: a.String(), Kind: "wrapper"})
 		}
-		if strings.HasPrefix(arg, "-") {
-			// Obsolete, but still supported syntax `-I <somedir>`
-			// Change to the regular syntax `-I=<somedir>`
-			if arg == "-I" && n < len(in)-1 {
-				in[n+1] = "-I=" + in[n+1]
-				continue
-			}
+		if a.flag == "--" {
+			// The separator is added back before the input files when they
+			// are passed to protoc, see appendFiles()
+			continue
+		}
+		if a.flag == "--resolve-only" {
+			// Wrapper-specific flag, handled by runProtoc
+			continue
+		}
+		if a.flag == "--check" {
+			// Wrapper-specific flag, compare generated code with the working tree
+			check = true
+			continue
+		}
+		if a.flag == "--force" {
+			// Wrapper-specific flag, run protoc even if outputs are up to date
+			force = true
+			continue
+		}
+		if a.flag == "--bundle" {
+			// Wrapper-specific flag, not passed to protoc
+			bundleNames = append(bundleNames, strings.Split(a.value, ",")...)
+			continue
+		}
+		if a.flag != "" {
 			// Command line options are passed as is, except for remote include paths
-			path := ""
-			for _, prefix := range []string{"--proto_path=", "-I=", "-I"} {
-				if strings.HasPrefix(arg, prefix) {
-					path = strings.TrimPrefix(arg, prefix)
-					break
+			arg = a.String()
+			if path := a.value; a.flag == "-I" && path != "" {
+				if _, err := os.Stat(path); os.IsNotExist(err) && isRemoteRef(path) {
+					// Remote include paths are resolved like remote files,
+					// repositories are checked out at the pinned revision.
+					// Missing local directories are left for protoc to report
+					ref := pinRevision(path)
+					local, err := downloadProto(ref)
+					if err != nil {
+						return nil, nil, nil, err
+					}
+					arg = "-I=" + local
+					steps = append(steps, explain(ref, "include", local, local))
 				}
 			}
-			if path != "" {
-				if _, err := os.Stat(path); os.IsNotExist(err) {
-					arg = "-I=" + cacheFile(filepath.Join("repos", path))
+			switch a.flag {
+			case "--descriptor_set_in":
+				paths := []string{}
+				for _, p := range splitPathList(a.value) {
+					local, ref, err := resolvePath(p)
+					if err != nil {
+						return nil, nil, nil, err
+					}
+					if local != p {
+						steps = append(steps, explain(ref, "descriptor_set", local, ""))
+					}
+					paths = append(paths, local)
 				}
+				arg = a.flag + "=" + strings.Join(paths, string(os.PathListSeparator))
+			case "--plugin":
+				// Plugin is either a path, or a name and a path: protoc-gen-NAME=PATH
+				name, p := "", a.value
+				if i := strings.Index(p, "="); i >= 0 {
+					name, p = p[:i+1], p[i+1:]
+				}
+				local, ref, err := resolvePath(p)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				if local != p {
+					// Plugins downloaded over HTTP are written without the
+					// executable bit. Files of replaced or cloned repositories
+					// are owned by the user and keep their mode.
+					if newResolver().SourceFor(ref) == "http" && isSubdir(cacheFile("archives"), local) {
+						if err := os.Chmod(local, 0755); err != nil {
+							return nil, nil, nil, err
+						}
+					}
+					steps = append(steps, explain(ref, "plugin", local, ""))
+				}
+				arg = a.flag + "=" + name + local
+			}
+			if arg == a.String() {
+				steps = append(steps, resolvedArg{Arg: arg, Kind: "flag"})
 			}
 			out = append(out, arg)
 		} else if _, err := os.Stat(arg); !os.IsNotExist(err) {
 			// Local proto files are passed as is. Stat() errors are ignored allowing
 			// protoc to handle it.
 			files = append(files, arg)
+			steps = append(steps, resolvedArg{Arg: arg, Kind: "file", Source: "local", Local: arg})
 		} else {
-			// Remote proto files are downloaded
-			local, err := downloadProto(arg)
+			// Remote files are resolved into the cache. Sources such as
+			// archives, Go modules and Maven artifacts provide their include
+			// root, repository files are included relative to their root.
+			root, local, err := downloadSource(arg)
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, nil, err
+			}
+			step := explain(arg, "file", local, root)
+			if root != "" {
+				step.Root = root
+			} else {
+				url, _ := resolver.SplitRev(arg)
+				root = remoteIncludeRoot(url, local)
+				step.Include = root
 			}
-			out = append(out, "-I"+filepath.Dir(local))
+			out = append(out, "-I"+root)
 			files = append(files, local)
+			steps = append(steps, step)
+		}
+	}
+	// Fetch remote imports referenced by the resolved files
+	fetcher := newImportFetcher(includePaths(out))
+	for _, f := range expandDirs(files) {
+		if err := fetcher.fetch(f); err != nil {
+			return nil, nil, nil, err
 		}
 	}
+	for _, ref := range sortedKeys(fetcher.downloaded) {
+		local := fetcher.downloaded[ref]
+		steps = append(steps, explain(ref, "import", local, strings.TrimSuffix(local, string(filepath.Separator)+filepath.FromSlash(strings.SplitN(ref, "@", 2)[0]))))
+	}
+	for _, root := range fetcher.roots {
+		out = append(out, "-I="+root)
+	}
 	//copy include files to cache
-	err := copyIncludesToCache(includesDir)
-	if err != nil {
-		return nil, nil, err
+	if err := copyIncludesToCache(includesDir); err != nil {
+		return nil, nil, nil, err
 	}
 	out = append(out, "-I="+cacheFile(filepath.Join(includesDir)))
-	return out, files, nil
+	used := map[string]bool{}
+	for _, name := range bundleNames {
+		if used[name] {
+			continue
+		}
+		used[name] = true
+		dir, err := copyBundleToCache(name)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		out = append(out, "-I="+dir)
+	}
+	return out, files, steps, nil
 }
 
-// copies the upstream proto includes to the cache.
-// Does not copy if the file is already present.
-func copyIncludesToCache(dirPath string) error {
-	dst := filepath.Join(cacheDir(), "protoc", version, dirPath)
-
-	err := os.MkdirAll(dst, includesCacheDirPermission)
+// virtualPath returns the path of the cached remote file relative to the
+// first include path that contains it, which is the name protoc resolves its
+// imports by. Passing remote files to protoc by such paths keeps the file
+// names in the generated code and descriptors independent of the cache
+// location, and the same for the files and their imports. Local files are
+// passed as is.
+func virtualPath(file string, includes []string) string {
+	cache, err := filepath.Abs(cacheFile())
 	if err != nil {
-		log.Fatal(err)
+		return file
 	}
-	dirs, err := include.ReadDir(dirPath)
-
+	abs, err := filepath.Abs(file)
 	if err != nil {
-		log.Fatal(err)
+		return file
 	}
-	for _, fd := range dirs {
-
-		if fd.IsDir() {
-			if err := copyIncludesToCache(path.Join(dirPath, fd.Name())); err != nil {
-				log.Fatal(err)
-			}
-			continue
-		}
-
-		srcFB, err := fs.ReadFile(include, path.Join(dirPath, fd.Name()))
-		if err != nil {
-			log.Fatal(err)
-		}
-		dstfp := path.Join(dst, fd.Name())
-
-		if _, err = os.Stat(dstfp); err != nil && os.IsNotExist(err) {
-			if err = ioutil.WriteFile(dstfp, srcFB, includesCacheFilePermission); err != nil {
-				log.Fatal(err)
+	if _, ok := relUnder(cache, abs); !ok {
+		return file
+	}
+	for _, dir := range includes {
+		if dir, err := filepath.Abs(dir); err == nil {
+			if rel, ok := relUnder(dir, abs); ok {
+				return rel
 			}
-		} else if err != nil {
-			log.Fatal(err)
 		}
 	}
+	return file
+}
 
+// copies the upstream proto includes to the cache.
+// Does not copy if the file is already present.
+func copyIncludesToCache(dirPath string) error {
+	_, err := newResolver().CopyIncludes(include, dirPath)
 	return err
 }
 
@@ -252,41 +313,52 @@ func expandDirs(dirs []string) []string {
 // execute runs a command with the provided arguments, using current stdio, and
 // returns command output and exit status (zero on success).
 func execute(exe string, args ...string) (string, int) {
+	if err := runCtx.Err(); err != nil {
+		return "", fail(err)
+	}
 	cmd := exec.Command(exe, args...)
 	var stdoutBuf bytes.Buffer
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = io.MultiWriter(os.Stdout, &stdoutBuf)
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
+	// Diagnostics refer to the remote files rather than their cache paths
+	stderr := &diagnosticsWriter{w: os.Stderr}
+	defer stderr.Flush()
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		// Protoc could not be run at all, e.g. the binary is missing
+		logError("protoc:", err)
+		return "", exitWrapper
+	}
+	// Signals received by the wrapper are forwarded to protoc
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-runCtx.Done():
+			terminate(cmd.Process, done)
+		case <-done:
+		}
+	}()
+	err := cmd.Wait()
+	close(done)
+	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				if status.Signaled() {
+					// Same as the shell status of a process killed by a signal
+					return "", 128 + int(status.Signal())
+				}
 				return "", status.ExitStatus()
 			}
 		}
+		logError("protoc:", err)
+		return "", exitWrapper
 	}
 	output := string(stdoutBuf.Bytes())
 	return output, 0
 }
 
-// cacheDir returns a path to the local user cache using XDG base directory
-// specification or OS standard directories.
-var cacheDir = func() string {
-	if dir := os.Getenv("PROTOC_CACHE_DIR"); dir != "" {
-		return dir
-	}
-	switch runtime.GOOS {
-	case "darwin":
-		return os.Getenv("HOME") + "/Library/Caches"
-	case "windows":
-		return os.Getenv("LOCALAPPDATA")
-	case "linux":
-		if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
-			return dir
-		}
-		return filepath.Join(os.Getenv("HOME"), ".cache")
-	}
-	return ""
-}
+// cacheDir returns a path to the local user cache.
+var cacheDir = resolver.DefaultCacheDir
 
 // cacheFile returns a path to the local user cache file inside the protoc
 // cache directory.
@@ -294,140 +366,158 @@ func cacheFile(path ...string) string {
 	return filepath.Join(append([]string{cacheDir(), "protoc", version}, path...)...)
 }
 
-// downloadProtoc downloads protoc binary for the current platform. Returns
-// absolute path to the protoc binary, or an error
-func downloadProtoc() (string, error) {
-	var arch string
-	var ok bool
-	runtimeArch := fmt.Sprintf("%s_%s", runtime.GOOS, runtime.GOARCH)
-	if arch, ok = platforms[runtimeArch]; !ok {
-		return "", fmt.Errorf("unable to resolve architecture for GOOS=%s GOARCH=%s", runtime.GOOS, runtime.GOARCH)
-	}
-
-	protocExeName := fmt.Sprintf("protoc-%s-%s_%s.exe", version, runtime.GOOS, runtime.GOARCH)
-	protocExePath := cacheFile(protocExeName)
-
-	if _, err := os.Stat(protocExePath); err == nil {
-		return protocExePath, nil
-	}
-
-	var err error
-	defer func() {
-		if err != nil {
-			// if we have download or checksum validation error need to clean up created file
-			// os.PathError let us know that temp empty file wasn't created by os.Create(), e.g. permission issue
-			if _, ok := err.(*os.PathError); !ok {
-				if rerr := os.Remove(protocExePath); rerr != nil {
-					fmt.Println("unable to delete file %w", rerr)
-				}
-			}
-		}
-	}()
-
-	log.Println("saving protoc to path: ", protocExePath)
-	url := fmt.Sprintf("%[1]s/%[2]s/protoc-%[2]s-%[3]s.exe", protoBinariesBaseURL, version, arch)
+// newResolver returns a resolver using the wrapper cache directory and log.
+func newResolver() *resolver.Resolver {
+	opts := []resolver.Option{resolver.WithCacheDir(cacheFile()), resolver.WithLogger(wrapperLogger{})}
+	return resolver.New(append(opts, sourceOptions()...)...)
+}
 
-	err = downloadFile(protocExePath, url)
-	if err != nil {
-		return "", err
-	}
-	err = os.Chmod(protocExePath, 0755)
+// runProtoc() is the main function. It is moved outside of main to make use of
+// defer statements. All that main() does now is os.Exit() which is not
+// defer-friendly at all.
+func runProtoc() int {
+	args, err := setupLogging(os.Args[1:])
 	if err != nil {
-		return "", err
+		return fail(&usageError{err})
 	}
-	cksum, err := download(url + ".md5")
-	if err != nil {
-		return "", err
+	if args, err = setupSources(args); err != nil {
+		return fail(&usageError{err})
 	}
-	f, err := os.Open(protocExePath)
+	ctx, cancel, args, err := setupContext(args)
 	if err != nil {
-		return "", err
-	}
-	defer f.Close()
-
-	h := md5.New()
-	if _, err = io.Copy(h, f); err != nil {
-		return "", err
-	}
-	if s := fmt.Sprintf("%x", h.Sum(nil)); s != string(cksum) {
-		err := fmt.Errorf("checksum mismatch: %s, %s, %s", url, s, string(cksum))
-		return "", err
+		return fail(&usageError{err})
 	}
+	defer cancel()
+	runCtx = ctx
+	os.Args = append(os.Args[:1], args...)
 
-	return protocExePath, nil
-}
-
-// runProtoc() is the main function. It is moved outside of main to make use of
-// defer statements. All that main() does now is os.Exit() which is not
-// defer-friendly at all.
-func runProtoc() int {
 	os.MkdirAll(cacheFile(), 0755)
 	lockFile, err := os.Create(cacheFile("protoc.lock"))
 	if err != nil {
-		log.Fatal(err)
+		return fail(err)
 	}
 	defer lockFile.Close()
 
 	if err := lock(lockFile); err != nil {
-		log.Fatal(err)
+		return fail(err)
 	}
 	defer unlock(lockFile)
 
+	if cfg, err = loadConfig(); err != nil {
+		return fail(&usageError{err})
+	}
+
+	// Warming the cache for other platforms never runs protoc
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		return runCache(os.Args[2:], os.Stdout)
+	}
+
+	// Resolution and the import graph never run protoc, so it is not
+	// downloaded either
+	if len(os.Args) > 1 && os.Args[1] == "graph" {
+		return runGraph(os.Args[2:], os.Stdout)
+	} else if len(os.Args) > 1 && os.Args[1] == "resolve" {
+		return runResolve(protocPath(), os.Args[2:], os.Stdout)
+	} else if parsed, err := parseProtocArgs(os.Args[1:]); err == nil && hasProtocFlag(parsed, "--resolve-only") {
+		return runResolve(protocPath(), os.Args[1:], os.Stdout)
+	}
+
 	protocExePath, err := downloadProtoc()
 	if err != nil {
-		log.Fatal("download protoc:", err)
+		return fail(err)
 	}
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "breaking":
+			return runBreaking(protocExePath, os.Args[2:], os.Stdout)
+		case "lint":
+			return runLint(protocExePath, os.Args[2:], os.Stdout)
+		}
+	}
+
+	// Version and help requests do not need any of the inputs to be resolved
+	if parsed, err := parseProtocArgs(os.Args[1:]); err == nil && hasProtocFlag(parsed, "--version") {
+		fmt.Println("protoc wrapper " + version)
+		_, exitCode := execute(protocExePath, "--version")
+		return exitCode
+	} else if err == nil && hasProtocFlag(parsed, "-h", "--help") {
+		_, exitCode := execute(protocExePath, "--help")
+		return exitCode
+	}
+
+	key := stampKey(os.Args[1:])
 	args, files, err := processArgs(os.Args[1:])
 	if err != nil {
-		log.Fatal(err)
+		return fail(err)
+	}
+
+	for _, dir := range includePaths(args) {
+		logDebug("Include path", displayPath(dir), "=>", dir)
 	}
 
 	files = expandDirs(files)
+	if check {
+		return checkProtoc(protocExePath, key, args, files)
+	}
+	fp, err := fingerprint(protocExePath, args, files)
+	if err != nil {
+		logWarn("fingerprint:", err)
+	} else if !force && len(files) > 0 && upToDate(key, fp) {
+		logInfo("Outputs are up to date, skipping protoc")
+		return 0
+	}
 	if len(files) == 0 {
 		_, err := execute(protocExePath, args...)
 		return err
 	}
+	// Generated files are listed by protoc in the dependency file, which is
+	// added unless it is requested by the user
+	depFile, depArgs := "", []string{}
+	if parsed, err := parseProtocArgs(args); err == nil && fp != "" && len(outputDirs(args)) > 0 {
+		for _, a := range parsed {
+			if a.flag == "--dependency_out" {
+				depFile = a.value
+			}
+		}
+		if depFile == "" {
+			tmp, err := ioutil.TempFile("", "protoc-deps-")
+			if err != nil {
+				return fail(err)
+			}
+			tmp.Close()
+			depFile = tmp.Name()
+			depArgs = append(depArgs, "--dependency_out="+depFile)
+			defer os.Remove(depFile)
+		}
+	}
+	outputs := []string{}
 	for _, f := range files {
-		if _, exitCode := execute(protocExePath, append(args, f)...); exitCode != 0 {
+		fileArgs := appendFiles(append(append([]string{}, args...), depArgs...), virtualPath(f, includePaths(args)))
+		if _, exitCode := execute(protocExePath, fileArgs...); exitCode != 0 {
 			return exitCode
 		}
+		if depFile != "" {
+			generated, err := dependencyOutputs(depFile)
+			if err != nil {
+				logWarn("dependency file:", err)
+				depFile = ""
+			}
+			outputs = append(outputs, generated...)
+		}
 	}
-	return 0
-}
-
-func download(url string) ([]byte, error) {
-	res, err := http.Get(url)
-	if err != nil {
-		return nil, err
+	if depFile != "" {
+		if err := saveStamp(key, fp, outputs); err != nil {
+			logWarn("save fingerprint:", err)
+		}
 	}
-	defer res.Body.Close()
-	return ioutil.ReadAll(res.Body)
+	return 0
 }
 
-// downloadFile downloads and saves file
-func downloadFile(filepath string, url string) (err error) {
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad status: %s", resp.Status)
-	}
-
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return err
-	}
-	return nil
+// httpGet sends a GET request using the credentials from $HOME/.netrc for the
+// host, if any.
+func httpGet(url string) (*http.Response, error) {
+	return newResolver().Get(runCtx, url)
 }
 
 func main() {
@@ -1,10 +1,10 @@
 package main
 
 import (
-	"fmt"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime"
 	"testing"
 )
@@ -24,59 +24,6 @@ func TestExecute(t *testing.T) {
 		t.Fatal(exit)
 	}
 }
-func Test_extractBranchMaster(t *testing.T) {
-	output := `* remote origin
-  Fetch URL: git@github.com:foo/bar.git
-  Push  URL: git@github.com:foo/bar.git
-  HEAD branch: master
-  Remote branch:
-    master tracked
-  Local branch configured for 'git pull':
-    master merges with remote master
-  Local ref configured for 'git push':
-    master pushes to master (up to date)
-`
-	branch := extractBranch(output)
-	if branch != "master" {
-		t.Fatal("failed extracting branch")
-	}
-}
-func Test_extractBranchMain(t *testing.T) {
-	output := `* remote origin
-  Fetch URL: git@github.com:foo/bar.git
-  Push  URL: git@github.com:foo/bar.git
-  HEAD branch: main
-  Remote branch:
-    master tracked
-  Local branch configured for 'git pull':
-    master merges with remote master
-  Local ref configured for 'git push':
-    master pushes to master (up to date)
-`
-	branch := extractBranch(output)
-	fmt.Println("branch is ", branch)
-	if branch != "main" {
-		t.Fatal("failed extracting branch")
-	}
-}
-func Test_extractBranchDefaultMasterBranch(t *testing.T) {
-	output := `* remote origin
-  Fetch URL: git@github.com:foo/bar.git
-  Push  URL: git@github.com:foo/bar.git
-  HEAD branch:
-  Remote branch:
-    master tracked
-  Local branch configured for 'git pull':
-    master merges with remote master
-  Local ref configured for 'git push':
-    master pushes to master (up to date)
-`
-	branch := extractBranch(output)
-	if branch != "master" {
-		t.Fatal("failed extracting branch")
-	}
-}
-
 func Test_copyIncludesToCache(t *testing.T) {
 	// given
 	// check if the includes are present in the project
@@ -106,3 +53,19 @@ func checkIfDirIsNotEmpty(t *testing.T, path string) {
 		assert.True(t, f.Size() != 0)
 	}
 }
+
+func Test_virtualPath(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+	defer func(f func() string) { cacheDir = f }(cacheDir)
+	cacheDir = func() string { return tempDir }
+
+	repo := cacheFile("repos", "github.com", "org", "repo")
+	includes := []string{"proto", filepath.Join(repo, "api"), repo}
+	assert.Equal(t, "v1/foo.proto", virtualPath(filepath.Join(repo, "api", "v1", "foo.proto"), includes))
+	assert.Equal(t, "other/foo.proto", virtualPath(filepath.Join(repo, "other", "foo.proto"), includes))
+	assert.Equal(t, filepath.Join("proto", "foo.proto"), virtualPath(filepath.Join("proto", "foo.proto"), includes))
+	assert.Equal(t, "foo.proto", virtualPath("foo.proto", includes))
+	assert.Equal(t, cacheFile("include", "google", "protobuf", "empty.proto"), virtualPath(cacheFile("include", "google", "protobuf", "empty.proto"), includes))
+}
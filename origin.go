@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// origin describes where a resolved proto file came from.
+type origin struct {
+	kind string // local, git, archive, gomod, maven, bundle, include or replaced
+	ref  string // repository URL, archive checksum, module, artifact or bundle name
+	rev  string // commit hash or version, if known
+	path string // file path relative to the ref
+}
+
+func (o origin) String() string {
+	switch o.kind {
+	case "local", "replaced":
+		return o.kind + " " + o.path
+	case "include":
+		return "protoc " + version + " " + o.path
+	}
+	s := o.kind + " " + o.ref
+	if o.rev != "" {
+		s = s + "@" + o.rev
+	}
+	if o.path != "" {
+		s = s + " " + o.path
+	}
+	return s
+}
+
+// display returns a machine-independent name of the file, e.g.
+// "github.com/org/repo/foo.proto@<rev>" for a file from a git repository.
+func (o origin) display() string {
+	if o.ref == "" {
+		return o.path
+	}
+	s := o.ref
+	if o.path != "" {
+		s = s + "/" + o.path
+	}
+	if o.rev != "" {
+		rev := o.rev
+		if o.kind == "git" && len(rev) > 12 {
+			rev = rev[:12]
+		}
+		s = s + "@" + rev
+	}
+	return s
+}
+
+// displayPath maps the local file or directory in the cache back to the
+// remote reference it came from. Paths outside of the cache are returned as
+// is.
+func displayPath(file string) string {
+	if o := fileOrigin(file); o.kind != "local" && o.display() != "" {
+		return o.display()
+	}
+	return file
+}
+
+// rewriteCachePaths replaces all the cache paths in the text with the remote
+// references.
+func rewriteCachePaths(s string) string {
+	prefixes := []string{cacheFile()}
+	if abs, err := filepath.Abs(prefixes[0]); err == nil && abs != prefixes[0] {
+		prefixes = append([]string{abs}, prefixes...)
+	}
+	for _, prefix := range prefixes {
+		re := regexp.MustCompile(regexp.QuoteMeta(prefix+string(filepath.Separator)) + `[^\s:"']+`)
+		s = re.ReplaceAllStringFunc(s, displayPath)
+	}
+	return s
+}
+
+// diagnosticsWriter rewrites cache paths in the output of protoc line by
+// line.
+type diagnosticsWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (d *diagnosticsWriter) Write(p []byte) (int, error) {
+	d.buf = append(d.buf, p...)
+	for {
+		i := bytes.IndexByte(d.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := io.WriteString(d.w, rewriteCachePaths(string(d.buf[:i+1]))); err != nil {
+			return 0, err
+		}
+		d.buf = d.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes the last incomplete line, if any.
+func (d *diagnosticsWriter) Flush() error {
+	if len(d.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(d.w, rewriteCachePaths(string(d.buf)))
+	d.buf = nil
+	return err
+}
+
+// relUnder returns the path of the file relative to the directory, and false
+// if the file is not inside of it.
+func relUnder(dir, file string) (string, bool) {
+	rel, err := filepath.Rel(dir, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// fileOrigin detects the origin of the local file by its location in the
+// cache.
+func fileOrigin(file string) origin {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	cache, err := filepath.Abs(cacheFile())
+	if err != nil {
+		return origin{kind: "local", path: file}
+	}
+	rel, ok := relUnder(cache, file)
+	if !ok {
+		return origin{kind: "local", path: file}
+	}
+	parts := strings.Split(rel, "/")
+	switch parts[0] {
+	case "repos":
+		dir := file
+		if info, err := os.Stat(file); err != nil || !info.IsDir() {
+			dir = filepath.Dir(file)
+		}
+		for {
+			if info, err := os.Stat(filepath.Join(dir, ".git")); err == nil && info.IsDir() {
+				url, _ := relUnder(filepath.Join(cache, "repos"), dir)
+				path, _ := relUnder(dir, file)
+				if path == "." {
+					path = ""
+				}
+				rev, _ := gitHead(dir)
+				return origin{kind: "git", ref: url, rev: rev, path: path}
+			}
+			if parent := filepath.Dir(dir); parent != dir && parent != filepath.Join(cache, "repos") {
+				dir = parent
+			} else {
+				break
+			}
+		}
+		return origin{kind: "git", path: strings.Join(parts[1:], "/")}
+	case "archives":
+		if len(parts) > 1 {
+			return origin{kind: "archive", ref: "sha256:" + parts[1], path: strings.Join(parts[2:], "/")}
+		}
+	case "gomod":
+		for i := 1; i < len(parts); i++ {
+			if at := strings.LastIndex(parts[i], "@"); at >= 0 {
+				mod := strings.Join(append(parts[1:i:i], parts[i][:at]), "/")
+				return origin{kind: "gomod", ref: mod, rev: parts[i][at+1:], path: strings.Join(parts[i+1:], "/")}
+			}
+		}
+	case "maven":
+		// The group path has a variable length, keep the whole path
+		return origin{kind: "maven", path: strings.Join(parts[1:], "/")}
+	case bundlesDir:
+		if len(parts) > 1 {
+			rev, _ := ioutil.ReadFile(filepath.Join(cache, bundlesDir, parts[1], "REVISION"))
+			return origin{kind: "bundle", ref: parts[1], rev: strings.TrimSpace(string(rev)), path: strings.Join(parts[2:], "/")}
+		}
+	case includesDir:
+		return origin{kind: "include", path: strings.Join(parts[1:], "/")}
+	case "replaced":
+		if target, err := filepath.EvalSymlinks(file); err == nil {
+			return origin{kind: "replaced", path: target}
+		}
+	}
+	return origin{kind: "local", path: file}
+}
+
+// gitHead returns the commit hash checked out in the git repository. It reads
+// the git metadata directly, so it works regardless of the git implementation.
+func gitHead(dir string) (string, error) {
+	gitDir := filepath.Join(dir, ".git")
+	b, err := ioutil.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return "", err
+	}
+	head := strings.TrimSpace(string(b))
+	if !strings.HasPrefix(head, "ref: ") {
+		return head, nil
+	}
+	ref := strings.TrimPrefix(head, "ref: ")
+	if b, err := ioutil.ReadFile(filepath.Join(gitDir, filepath.FromSlash(ref))); err == nil {
+		return strings.TrimSpace(string(b)), nil
+	}
+	f, err := os.Open(filepath.Join(gitDir, "packed-refs"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[1] == ref {
+			return fields[0], nil
+		}
+	}
+	return "", errors.New("unknown ref: " + ref)
+}
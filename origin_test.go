@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileOrigin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(f func() string) { cacheDir = f }(cacheDir)
+	cacheDir = func() string { return filepath.Join(dir, "cache") }
+
+	repo := cacheFile("repos", "github.com", "org", "repo")
+	os.MkdirAll(filepath.Join(repo, ".git", "refs", "heads"), 0755)
+	ioutil.WriteFile(filepath.Join(repo, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0644)
+	ioutil.WriteFile(filepath.Join(repo, ".git", "packed-refs"), []byte("# pack-refs\n0123abcd refs/heads/main\n"), 0644)
+	assert.Equal(t, "git github.com/org/repo@0123abcd api/foo.proto", fileOrigin(filepath.Join(repo, "api", "foo.proto")).String())
+	ioutil.WriteFile(filepath.Join(repo, ".git", "HEAD"), []byte("4567cdef\n"), 0644)
+	assert.Equal(t, "4567cdef", fileOrigin(filepath.Join(repo, "foo.proto")).rev)
+
+	assert.Equal(t, origin{kind: "gomod", ref: "github.com/!org/mod", rev: "v1.2.3", path: "api/foo.proto"},
+		fileOrigin(cacheFile("gomod", "github.com", "!org", "mod@v1.2.3", "api", "foo.proto")))
+	assert.Equal(t, "protoc "+version+" google/protobuf/empty.proto", fileOrigin(cacheFile(includesDir, "google", "protobuf", "empty.proto")).String())
+	assert.Equal(t, "local "+filepath.Join(dir, "foo.proto"), fileOrigin(filepath.Join(dir, "foo.proto")).String())
+}
+
+func TestRewriteCachePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(f func() string) { cacheDir = f }(cacheDir)
+	cacheDir = func() string { return filepath.Join(dir, "cache") }
+
+	repo := cacheFile("repos", "github.com", "org", "repo")
+	os.MkdirAll(filepath.Join(repo, ".git"), 0755)
+	ioutil.WriteFile(filepath.Join(repo, ".git", "HEAD"), []byte("0123456789abcdef0123456789abcdef01234567\n"), 0644)
+	assert.Equal(t, "github.com/org/repo@0123456789ab", displayPath(repo))
+	assert.Equal(t, "foo.proto", displayPath("foo.proto"))
+
+	var buf bytes.Buffer
+	w := &diagnosticsWriter{w: &buf}
+	w.Write([]byte(filepath.Join(repo, "api", "foo.proto") + ":12:3: Expected \";\".\n" + filepath.Join(repo, "api")))
+	assert.Equal(t, "github.com/org/repo/api/foo.proto@0123456789ab:12:3: Expected \";\".\n", buf.String())
+	w.Write([]byte(": warning: directory does not exist."))
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "github.com/org/repo/api/foo.proto@0123456789ab:12:3: Expected \";\".\ngithub.com/org/repo/api@0123456789ab: warning: directory does not exist.", buf.String())
+}
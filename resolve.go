@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sixt/protoc/v3/resolver"
+)
+
+// resolvedArg explains how a single protoc argument or a remote import was
+// resolved.
+type resolvedArg struct {
+	Arg      string `json:"arg"`
+	Kind     string `json:"kind"`               // file, include, flag, plugin, descriptor_set, import or wrapper
+	Source   string `json:"source,omitempty"`   // local, git, archive, gomod, maven, bundle or replaced
+	URL      string `json:"url,omitempty"`      // clone URL of the repository
+	Root     string `json:"root,omitempty"`     // local repository or unpacked package directory
+	Revision string `json:"revision,omitempty"` // requested revision
+	Resolved string `json:"resolved,omitempty"` // checked out commit or version
+	Local    string `json:"local,omitempty"`
+	Include  string `json:"include,omitempty"` // include path added for the argument
+}
+
+// explain describes the remote reference resolved into the local path.
+func explain(ref, kind, local, include string) resolvedArg {
+	r := resolvedArg{Arg: ref, Kind: kind, Local: local, Include: include}
+	switch newResolver().SourceFor(ref) {
+	case "http", "gomod", "maven":
+		// Versions are part of the URL or of the coordinates
+	default:
+		_, r.Revision = resolver.SplitRev(ref)
+	}
+	o := fileOrigin(local)
+	r.Source = o.kind
+	switch o.kind {
+	case "git":
+		r.URL = newResolver().CloneURL(o.ref)
+		r.Root = cacheFile("repos", filepath.FromSlash(o.ref))
+		r.Resolved = o.rev
+	case "gomod", "bundle":
+		r.Resolved = o.rev
+	case "replaced":
+		r.Local = o.path
+	case "local":
+		if url, _ := resolver.SplitRev(ref); url != "" {
+			if _, ok := cfg.replace(url); ok {
+				r.Source = "replaced"
+			}
+		}
+	}
+	return r
+}
+
+func (r resolvedArg) writeText(w io.Writer) {
+	fmt.Fprintf(w, "%s (%s)\n", r.Arg, r.Kind)
+	for _, field := range []struct{ name, value string }{
+		{"source", r.Source},
+		{"url", r.URL},
+		{"root", r.Root},
+		{"revision", r.Revision},
+		{"resolved", r.Resolved},
+		{"local", r.Local},
+		{"include", r.Include},
+	} {
+		if field.value != "" {
+			fmt.Fprintf(w, "  %-9s %s\n", field.name+":", field.value)
+		}
+	}
+}
+
+// protocCommands returns the protoc command lines that would be executed for
+// the resolved arguments and files.
+func protocCommands(protocExePath string, args, files []string) [][]string {
+	if len(files) == 0 {
+		return [][]string{append([]string{protocExePath}, args...)}
+	}
+	commands := [][]string{}
+	for _, f := range files {
+		cmd := appendFiles(append([]string{protocExePath}, args...), virtualPath(f, includePaths(args)))
+		commands = append(commands, cmd)
+	}
+	return commands
+}
+
+// runResolve implements `protoc resolve [--format=text|json] [protoc flags]
+// <file or ref>...` and `protoc --resolve-only ...`. It resolves the arguments
+// without running protoc, and prints how every argument was resolved.
+func runResolve(protocExePath string, args []string, w io.Writer) int {
+	format := "text"
+	rest := []string{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--format=") {
+			format = strings.TrimPrefix(arg, "--format=")
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	if format != "text" && format != "json" {
+		fmt.Fprintln(os.Stderr, "USAGE: protoc resolve [--format=text|json] [protoc flags] <file>...")
+		return exitUsage
+	}
+	out, files, steps, err := resolveArgs(rest)
+	if err != nil {
+		return fail(err)
+	}
+	commands := protocCommands(protocExePath, out, expandDirs(files))
+	if format == "json" {
+		if steps == nil {
+			steps = []resolvedArg{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(struct {
+			Arguments []resolvedArg `json:"arguments"`
+			Commands  [][]string    `json:"commands"`
+		}{steps, commands})
+		return 0
+	}
+	for _, step := range steps {
+		step.writeText(w)
+	}
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintln(w, " ", strings.Join(cmd, " "))
+	}
+	return 0
+}
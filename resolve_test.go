@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunResolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(f func() string) { cacheDir = f }(cacheDir)
+	cacheDir = func() string { return filepath.Join(dir, "cache") }
+	defer func(c *config) { cfg = c }(cfg)
+	defer func() { force = false }()
+	common := filepath.Join(dir, "common")
+	cfg = &config{Replace: map[string]string{"github.com/org/common": common}}
+
+	os.MkdirAll(common, 0755)
+	ioutil.WriteFile(filepath.Join(common, "money.proto"), []byte("syntax = \"proto3\";\n"), 0644)
+	local := filepath.Join(dir, "foo.proto")
+	ioutil.WriteFile(local, []byte("import \"github.com/org/common/money.proto\";\n"), 0644)
+
+	var buf bytes.Buffer
+	assert.Equal(t, 0, runResolve("protoc", []string{"--format=json", "--go_out", "gen", local, "--force"}, &buf))
+	var result struct {
+		Arguments []resolvedArg `json:"arguments"`
+		Commands  [][]string    `json:"commands"`
+	}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &result))
+	assert.Equal(t, []resolvedArg{
+		{Arg: "--go_out=gen", Kind: "flag"},
+		{Arg: local, Kind: "file", Source: "local", Local: local},
+		{Arg: "--force", Kind: "wrapper"},
+		{Arg: "github.com/org/common/money.proto", Kind: "import", Source: "replaced", Local: filepath.Join(common, "money.proto"), Include: cacheFile("replaced")},
+	}, result.Arguments)
+	assert.Equal(t, [][]string{{"protoc", "--go_out=gen", "-I=" + cacheFile("replaced"), "-I=" + cacheFile(includesDir), local}}, result.Commands)
+
+	buf.Reset()
+	assert.Equal(t, 0, runResolve("protoc", []string{local}, &buf))
+	assert.Contains(t, buf.String(), local+" (file)\n  source:   local\n")
+	assert.Contains(t, buf.String(), "Commands:\n  protoc -I="+cacheFile("replaced"))
+	assert.Equal(t, 2, runResolve("protoc", []string{"--format=xml", local}, &buf))
+}
@@ -0,0 +1,63 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// command runs a version control tool, such as git or hg.
+type command struct {
+	name string
+	log  Logger
+}
+
+// run runs the tool and returns its standard output. The output of the tool
+// is captured and only logged in debug mode. A failed command may be just one
+// of several attempts, e.g. of cloning each prefix of the URL, so its output
+// is reported through the returned error rather than logged.
+func (c *command) run(ctx context.Context, args ...string) (string, error) {
+	c.log.Debug(c.name, strings.Join(args, " "))
+	var stdout, combined bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.name, args...)
+	cmd.Stdout = io.MultiWriter(&stdout, &combined)
+	cmd.Stderr = &combined
+	if err := cmd.Run(); err != nil {
+		logOutput(c.log.Debug, c.name, combined.String())
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("%s failed: %w", c.name, ctx.Err())
+		}
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			msg := fmt.Sprintf("%s failed: exit code %d", c.name, exitErr.ExitCode())
+			if lines := outputLines(combined.String()); len(lines) > 0 {
+				msg += ":\n\t" + strings.Join(lines, "\n\t")
+			}
+			return "", &Error{Kind: classifyOutput(combined.String()), Causes: []error{errors.New(msg)}}
+		}
+		return "", fmt.Errorf("%s failed: %w", c.name, err)
+	}
+	logOutput(c.log.Debug, c.name, combined.String())
+	return stdout.String(), nil
+}
+
+// logOutput logs the captured output of the tool line by line.
+func logOutput(log func(v ...interface{}), name, output string) {
+	for _, line := range outputLines(output) {
+		log(name+":", line)
+	}
+}
+
+// outputLines returns the non-empty lines of the captured output.
+func outputLines(output string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,94 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func Test_extractBranchMaster(t *testing.T) {
+	output := `* remote origin
+  Fetch URL: git@github.com:foo/bar.git
+  Push  URL: git@github.com:foo/bar.git
+  HEAD branch: master
+  Remote branch:
+    master tracked
+  Local branch configured for 'git pull':
+    master merges with remote master
+  Local ref configured for 'git push':
+    master pushes to master (up to date)
+`
+	branch := extractBranch(output)
+	if branch != "master" {
+		t.Fatal("failed extracting branch")
+	}
+}
+func Test_extractBranchMain(t *testing.T) {
+	output := `* remote origin
+  Fetch URL: git@github.com:foo/bar.git
+  Push  URL: git@github.com:foo/bar.git
+  HEAD branch: main
+  Remote branch:
+    master tracked
+  Local branch configured for 'git pull':
+    master merges with remote master
+  Local ref configured for 'git push':
+    master pushes to master (up to date)
+`
+	branch := extractBranch(output)
+	fmt.Println("branch is ", branch)
+	if branch != "main" {
+		t.Fatal("failed extracting branch")
+	}
+}
+func Test_extractBranchDefaultMasterBranch(t *testing.T) {
+	output := `* remote origin
+  Fetch URL: git@github.com:foo/bar.git
+  Push  URL: git@github.com:foo/bar.git
+  HEAD branch:
+  Remote branch:
+    master tracked
+  Local branch configured for 'git pull':
+    master merges with remote master
+  Local ref configured for 'git push':
+    master pushes to master (up to date)
+`
+	branch := extractBranch(output)
+	if branch != "master" {
+		t.Fatal("failed extracting branch")
+	}
+}
+
+func Test_logOutput(t *testing.T) {
+	lines := []string{}
+	logOutput(func(v ...interface{}) { lines = append(lines, fmt.Sprint(v...)) }, "git", "fatal: not found\n\nhint: check\n")
+	if len(lines) != 2 || lines[0] != "git:fatal: not found" || lines[1] != "git:hint: check" {
+		t.Fatal(lines)
+	}
+}
+
+// recordingLogger records the messages by level.
+type recordingLogger map[string][]string
+
+func (l recordingLogger) Debug(v ...interface{}) { l["debug"] = append(l["debug"], fmt.Sprint(v...)) }
+func (l recordingLogger) Info(v ...interface{})  { l["info"] = append(l["info"], fmt.Sprint(v...)) }
+func (l recordingLogger) Warn(v ...interface{})  { l["warn"] = append(l["warn"], fmt.Sprint(v...)) }
+func (l recordingLogger) Error(v ...interface{}) { l["error"] = append(l["error"], fmt.Sprint(v...)) }
+
+func Test_runFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	log := recordingLogger{}
+	c := &command{name: "sh", log: log}
+	_, err := c.run(context.Background(), "-c", "echo 'fatal: repository not found' >&2; echo 'hint: check the URL' >&2; exit 128")
+	if KindOf(err) != KindNotFound || !strings.Contains(err.Error(), "exit code 128:\n\tfatal: repository not found\n\thint: check the URL") {
+		t.Fatal(err)
+	}
+	// Failed attempts are not errors of the whole operation
+	if len(log["error"]) != 0 || len(log["warn"]) != 0 || len(log["debug"]) != 3 {
+		t.Fatal(log)
+	}
+}
@@ -0,0 +1,115 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+)
+
+// Kind classifies the resolution errors. Kinds are ordered by how specific
+// they are: an error aggregating several attempts has the highest kind of
+// its causes.
+type Kind int
+
+const (
+	KindUnknown Kind = iota
+	KindNotFound
+	KindRevisionNotFound
+	KindNetwork
+	KindAuth
+	KindChecksum
+)
+
+var kindNames = []string{"error", "not found", "revision not found", "network error", "authentication failed", "checksum mismatch"}
+
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// Error is a failure to resolve a reference. It aggregates the causes of all
+// the attempts, e.g. of cloning the repository at every prefix of the URL.
+type Error struct {
+	Kind   Kind
+	Ref    string
+	Causes []error
+}
+
+// NewError returns an error of the reference classified by the most specific
+// of its causes.
+func NewError(ref string, causes ...error) *Error {
+	e := &Error{Ref: ref, Causes: causes}
+	for _, err := range causes {
+		if k := KindOf(err); k > e.Kind {
+			e.Kind = k
+		}
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	causes := make([]string, len(e.Causes))
+	for i, err := range e.Causes {
+		causes[i] = err.Error()
+	}
+	if e.Ref == "" {
+		return strings.Join(causes, "; ")
+	}
+	msg := e.Kind.String() + ": " + e.Ref
+	if len(causes) > 0 {
+		msg += ": " + strings.Join(causes, "; ")
+	}
+	return msg
+}
+
+// Unwrap returns the cause of the last attempt.
+func (e *Error) Unwrap() error {
+	if len(e.Causes) == 0 {
+		return nil
+	}
+	return e.Causes[len(e.Causes)-1]
+}
+
+// KindOf returns the kind of the error. Network failures that are not
+// classified by the resolver are reported as KindNetwork, timeouts and
+// cancellations are not network failures even though the context errors
+// implement net.Error.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return KindUnknown
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return KindNetwork
+	}
+	return KindUnknown
+}
+
+// outputKinds are the messages of git and hg that classify their failures.
+// The first matching kind wins.
+var outputKinds = []struct {
+	kind     Kind
+	messages []string
+}{
+	{KindAuth, []string{"authentication failed", "could not read username", "permission denied", "authorization failed", "error: 401", "error: 403", "http error 401", "http error 403"}},
+	{KindRevisionNotFound, []string{"did not match any file(s) known to git", "unknown revision", "reference is not a tree", "invalid reference"}},
+	{KindNotFound, []string{"not found", "does not appear to be a git repository", "does not exist", "error: 404", "http error 404"}},
+	{KindNetwork, []string{"could not resolve host", "unable to access", "failed to connect", "connection refused", "connection timed out", "network is unreachable", "name or service not known"}},
+}
+
+// classifyOutput returns the kind of the failure from the command output.
+func classifyOutput(output string) Kind {
+	output = strings.ToLower(output)
+	for _, k := range outputKinds {
+		for _, msg := range k.messages {
+			if strings.Contains(output, msg) {
+				return k.kind
+			}
+		}
+	}
+	return KindUnknown
+}
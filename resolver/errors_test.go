@@ -0,0 +1,82 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewError(t *testing.T) {
+	e := NewError("example.com/org/repo",
+		&Error{Kind: KindNotFound, Causes: []error{errors.New("clone example.com: not found")}},
+		&Error{Kind: KindAuth, Causes: []error{errors.New("clone example.com/org: denied")}},
+		errors.New("clone example.com/org/repo: failed"),
+	)
+	assert.Equal(t, KindAuth, e.Kind)
+	assert.Equal(t, "authentication failed: example.com/org/repo: clone example.com: not found; clone example.com/org: denied; clone example.com/org/repo: failed", e.Error())
+	assert.Equal(t, KindAuth, KindOf(e))
+	assert.Equal(t, KindUnknown, KindOf(errors.New("failed")))
+	assert.Equal(t, KindUnknown, KindOf(fmt.Errorf("clone: %w", context.DeadlineExceeded)))
+	assert.Equal(t, KindUnknown, NewError("example.com/org/repo", context.Canceled).Kind)
+}
+
+func TestClassifyOutput(t *testing.T) {
+	for output, kind := range map[string]Kind{
+		"remote: Repository not found.\nfatal: repository 'https://github.com/org/missing/' not found\n": KindNotFound,
+		"fatal: could not read Username for 'https://github.com': terminal prompts disabled\n":           KindAuth,
+		"error: pathspec 'v9.9.9' did not match any file(s) known to git\n":                              KindRevisionNotFound,
+		"fatal: unable to access 'https://example.com/repo/': Could not resolve host: example.com\n":     KindNetwork,
+		"abort: unknown revision 'v9'!\n": KindRevisionNotFound,
+		"fatal: unable to access 'https://example.com/repo/': The requested URL returned error: 403\n": KindAuth,
+		"fatal: the remote end hung up unexpectedly\n":                                                 KindUnknown,
+	} {
+		assert.Equal(t, kind, classifyOutput(output), output)
+	}
+}
+
+type failingBackend struct {
+	fakeBackend
+	kind Kind
+}
+
+func (b *failingBackend) Clone(ctx context.Context, url, dir string) (Repo, error) {
+	return nil, &Error{Kind: b.kind, Causes: []error{errors.New("git failed")}}
+}
+
+func TestCloneErrors(t *testing.T) {
+	r := New(WithCacheDir(t.TempDir()), WithBackend(&failingBackend{kind: KindNotFound}))
+	_, err := r.Resolve(context.Background(), "example.com/org/repo/foo.proto")
+	var e *Error
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, KindNotFound, e.Kind)
+	assert.Equal(t, "example.com/org/repo/foo.proto", e.Ref)
+	// Every prefix of the URL is attempted
+	assert.Len(t, e.Causes, 4)
+	assert.Contains(t, e.Causes[1].Error(), "clone example.com/org: git failed")
+}
+
+func TestDownloadErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/private":
+			w.WriteHeader(http.StatusForbidden)
+		case "/broken":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	r := New(WithAuth(nil))
+	for path, kind := range map[string]Kind{"/private": KindAuth, "/broken": KindNetwork, "/missing": KindNotFound} {
+		_, err := r.download(context.Background(), srv.URL+path)
+		assert.Equal(t, kind, KindOf(err), path)
+	}
+	_, err := r.download(context.Background(), "http://127.0.0.1:1/closed")
+	assert.Equal(t, KindNetwork, KindOf(err))
+}
@@ -0,0 +1,28 @@
+package resolver
+
+import "context"
+
+// Backend is a git implementation used to clone and open cached
+// repositories.
+type Backend interface {
+	// Open opens the repository of the URL cloned into the directory.
+	Open(ctx context.Context, url, dir string) (Repo, error)
+	// Clone clones the repository of the URL into the directory.
+	Clone(ctx context.Context, url, dir string) (Repo, error)
+}
+
+// Repo is a cloned git repository.
+type Repo interface {
+	// Checkout checks out the revision: a tag, a branch or a commit. The
+	// default branch is used if the revision is empty or LatestRev.
+	Checkout(ctx context.Context, rev string) error
+	// Fetch fetches the new revisions from the remote repository.
+	Fetch(ctx context.Context) error
+}
+
+// RemoteURLer is implemented by the backends that can tell the remote URL
+// the repository of the URL is cloned from, e.g. "https://github.com/org/repo"
+// for "github.com/org/repo".
+type RemoteURLer interface {
+	RemoteURL(url string) string
+}
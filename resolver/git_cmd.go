@@ -0,0 +1,66 @@
+package resolver
+
+import (
+	"context"
+	"regexp"
+)
+
+type cmdBackend struct {
+	command
+}
+
+type cmdRepo struct {
+	git *cmdBackend
+	url string
+	dir string
+}
+
+var re = regexp.MustCompile(`.*HEAD branch: (.*)\n`) // regex to extract default branch name of a repo
+
+// NewCmdGitBackend returns the git implementation using the command line git
+// tool. It uses the git credential helpers for authentication.
+func NewCmdGitBackend(log Logger) Backend {
+	return &cmdBackend{command{name: "git", log: log}}
+}
+
+func (g *cmdBackend) Open(ctx context.Context, url, dir string) (Repo, error) {
+	_, err := g.run(ctx, "-C", dir, "rev-parse")
+	return &cmdRepo{git: g, url: url, dir: dir}, err
+}
+
+func (g *cmdBackend) RemoteURL(url string) string {
+	return "https://" + url
+}
+
+func (g *cmdBackend) Clone(ctx context.Context, url, dir string) (Repo, error) {
+	_, err := g.run(ctx, "clone", g.RemoteURL(url), dir)
+	return &cmdRepo{git: g, url: url, dir: dir}, err
+}
+
+func (r *cmdRepo) Checkout(ctx context.Context, rev string) error {
+	output, err := r.git.run(ctx, "-C", r.dir, "remote", "show", "origin")
+	if err != nil {
+		return err
+	}
+	defaultBranch := extractBranch(output)
+	if _, err := r.git.run(ctx, "-C", r.dir, "checkout", defaultBranch); err != nil {
+		return err
+	}
+	if rev == "" || rev == LatestRev {
+		rev = "HEAD"
+	}
+	_, err = r.git.run(ctx, "-C", r.dir, "checkout", "-q", rev)
+	return err
+}
+
+func (r *cmdRepo) Fetch(ctx context.Context) error {
+	_, err := r.git.run(ctx, "-C", r.dir, "pull")
+	return err
+}
+
+func extractBranch(output string) string {
+	if !re.MatchString(output) {
+		return "master"
+	}
+	return re.FindStringSubmatch(output)[1]
+}
@@ -0,0 +1,160 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	plumbing "github.com/go-git/go-git/v5/plumbing"
+	transport "github.com/go-git/go-git/v5/plumbing/transport"
+	http "github.com/go-git/go-git/v5/plumbing/transport/http"
+	ssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+type goGitBackend struct {
+	log  Logger
+	auth Auth
+}
+
+// NewGoGitBackend returns the git implementation using the go-git library. It
+// uses the credentials from auth for HTTPS, or the SSH agent if there are no
+// credentials for the host.
+func NewGoGitBackend(log Logger, auth Auth) Backend {
+	return &goGitBackend{log: log, auth: auth}
+}
+
+func (g *goGitBackend) httpAuth(importPath string) transport.AuthMethod {
+	u, err := url.Parse("https://" + importPath)
+	if err != nil || g.auth == nil {
+		return nil
+	}
+	username, password := g.auth(u.Host)
+	if username == "" && password == "" {
+		return nil
+	}
+	return &http.BasicAuth{Username: username, Password: password}
+}
+
+func sshAuth() transport.AuthMethod {
+	auth, err := ssh.NewSSHAgentAuth("git")
+	if err != nil {
+		// Avoid returning a typed nil pointer as a non-nil interface
+		return nil
+	}
+	return auth
+}
+
+func (g *goGitBackend) authMethod(url string) (transport.AuthMethod, string) {
+	auth := g.httpAuth(url)
+	schema := "https://"
+	if auth == nil {
+		auth = sshAuth()
+		schema = "ssh://"
+	}
+	return auth, schema
+}
+
+type goGitRepo struct {
+	git  *goGitBackend
+	url  string
+	repo *git.Repository
+}
+
+func (g *goGitBackend) Open(ctx context.Context, url, dir string) (Repo, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &goGitRepo{git: g, url: url, repo: r}, nil
+}
+
+func (g *goGitBackend) RemoteURL(url string) string {
+	_, schema := g.authMethod(url)
+	return schema + url + ".git"
+}
+
+func (g *goGitBackend) Clone(ctx context.Context, url, dir string) (Repo, error) {
+	auth, schema := g.authMethod(url)
+	r, err := git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+		URL:  schema + url + ".git",
+		Auth: auth,
+	})
+	if err != nil {
+		return nil, goGitError(err)
+	}
+	return &goGitRepo{git: g, url: url, repo: r}, nil
+}
+
+func (r *goGitRepo) Checkout(ctx context.Context, rev string) error {
+	w, err := r.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if rev == "" || rev == LatestRev {
+		ref, err := r.repo.Head()
+		if err != nil {
+			return err
+		}
+		rev = ref.Hash().String()
+		r.git.log.Debug("Using HEAD revision", rev)
+	} else {
+		tagrefs, err := r.repo.Tags()
+		if err != nil {
+			return err
+		}
+		found := false
+		tagrefs.ForEach(func(t *plumbing.Reference) error {
+			if !found && strings.TrimPrefix(t.Name().String(), "refs/tags/") == rev {
+				found = true
+				rev = t.Hash().String()
+				annotated, err := r.repo.TagObject(t.Hash())
+				if err == nil {
+					rev = annotated.Target.String()
+				}
+				r.git.log.Debug("Using tag ", t.Name().String(), "revision", rev)
+			}
+			return nil
+		})
+	}
+
+	err = w.Checkout(&git.CheckoutOptions{
+		Hash: plumbing.NewHash(rev),
+	})
+	if err != nil {
+		return goGitError(err)
+	}
+	return nil
+}
+
+func (r *goGitRepo) Fetch(ctx context.Context) error {
+	w, err := r.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	auth, _ := r.git.authMethod(r.url)
+	if err := w.PullContext(ctx, &git.PullOptions{
+		RemoteName: "origin",
+		Auth:       auth,
+	}); err != nil && err != git.NoErrAlreadyUpToDate {
+		// Ignore if pull fails, try our best to work offline
+		return goGitError(err)
+	}
+	return nil
+}
+
+// goGitError classifies the errors of the go-git library.
+func goGitError(err error) error {
+	kind := KindOf(err)
+	switch {
+	case errors.Is(err, transport.ErrAuthenticationRequired), errors.Is(err, transport.ErrAuthorizationFailed):
+		kind = KindAuth
+	case errors.Is(err, transport.ErrRepositoryNotFound), errors.Is(err, transport.ErrEmptyRemoteRepository):
+		kind = KindNotFound
+	case errors.Is(err, plumbing.ErrReferenceNotFound), errors.Is(err, plumbing.ErrObjectNotFound):
+		kind = KindRevisionNotFound
+	}
+	return &Error{Kind: kind, Causes: []error{fmt.Errorf("go-git: %w", err)}}
+}
@@ -0,0 +1,396 @@
+package resolver
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const goModScheme = "gomod://"
+
+// parseGoModRef splits the reference, e.g.
+// `gomod://github.com/org/module/v2@v2.1.0/path/to/foo.proto`, into module path, version and a path
+// inside the module. If the version is omitted, the module is looked up in the
+// requirements of the current go.mod file.
+func parseGoModRef(ref string) (string, string, string, error) {
+	ref = strings.TrimPrefix(ref, goModScheme)
+	if i := strings.Index(ref, "@"); i >= 0 {
+		mod, rest := ref[:i], ref[i+1:]
+		version, sub := rest, ""
+		if j := strings.Index(rest, "/"); j >= 0 {
+			version, sub = rest[:j], rest[j+1:]
+		}
+		if mod == "" || version == "" {
+			return "", "", "", fmt.Errorf("malformed go module reference: %s", ref)
+		}
+		return mod, version, sub, nil
+	}
+	gomod, err := findGoMod()
+	if err != nil {
+		return "", "", "", err
+	}
+	mod, sub, ok := gomod.require(ref)
+	if !ok {
+		return "", "", "", fmt.Errorf("no module providing %s in go.mod", ref)
+	}
+	return mod, gomod.requires[mod], sub, nil
+}
+
+// goModFile is the part of the go.mod file used to resolve module references.
+type goModFile struct {
+	dir      string
+	requires map[string]string
+	// replaces maps "module" or "module@version" to a local directory or to
+	// "module@version" of the replacement.
+	replaces map[string]string
+}
+
+// findGoMod reads the go.mod file found in the current directory or any of
+// its parents.
+func findGoMod() (*goModFile, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		f, err := os.Open(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			defer f.Close()
+			gomod, err := parseGoMod(bufio.NewScanner(f))
+			if err != nil {
+				return nil, err
+			}
+			gomod.dir = dir
+			return gomod, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, errors.New("go.mod not found")
+		}
+		dir = parent
+	}
+}
+
+func parseGoMod(scanner *bufio.Scanner) (*goModFile, error) {
+	gomod := &goModFile{requires: map[string]string{}, replaces: map[string]string{}}
+	block := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case block != "" && fields[0] == ")":
+			block = ""
+		case block != "":
+			gomod.parseDirective(block, fields)
+		case fields[0] != "require" && fields[0] != "replace":
+		case len(fields) == 2 && fields[1] == "(":
+			block = fields[0]
+		default:
+			gomod.parseDirective(fields[0], fields[1:])
+		}
+	}
+	return gomod, scanner.Err()
+}
+
+// parseDirective adds a single requirement or replacement, e.g.
+// `example.com/foo v1.0.0 => ../foo`.
+func (gomod *goModFile) parseDirective(directive string, fields []string) {
+	if directive == "require" && len(fields) >= 2 {
+		gomod.requires[fields[0]] = fields[1]
+		return
+	}
+	for i, f := range fields {
+		if f == "=>" {
+			old, replacement := fields[:i], fields[i+1:]
+			if len(old) >= 1 && len(old) <= 2 && len(replacement) >= 1 && len(replacement) <= 2 {
+				gomod.replaces[strings.Join(old, "@")] = strings.Join(replacement, "@")
+			}
+			return
+		}
+	}
+}
+
+// require returns the longest required module path that is a prefix of the
+// path on a path element boundary, and the path inside the module.
+func (gomod *goModFile) require(p string) (string, string, bool) {
+	mods := make([]string, 0, len(gomod.requires))
+	for mod := range gomod.requires {
+		mods = append(mods, mod)
+	}
+	sort.Slice(mods, func(i, j int) bool { return len(mods[i]) > len(mods[j]) })
+	for _, mod := range mods {
+		if p == mod {
+			return mod, "", true
+		}
+		if strings.HasPrefix(p, mod+"/") {
+			return mod, p[len(mod)+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// replace returns the replacement of the module version: either a local
+// directory, or a module path and version.
+func (gomod *goModFile) replace(mod, version string) (string, string, string) {
+	r, ok := gomod.replaces[mod+"@"+version]
+	if !ok {
+		if r, ok = gomod.replaces[mod]; !ok {
+			return mod, version, ""
+		}
+	}
+	if i := strings.Index(r, "@"); i >= 0 {
+		return r[:i], r[i+1:], ""
+	}
+	if !filepath.IsAbs(r) {
+		r = filepath.Join(gomod.dir, filepath.FromSlash(r))
+	}
+	return mod, version, r
+}
+
+// escapeModulePath escapes upper case letters in module paths and versions
+// the same way as the go command does it in the module cache and proxy URLs.
+func escapeModulePath(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteByte('!')
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// goModCache returns the Go module cache directory.
+func goModCache() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	if gopath := filepath.SplitList(os.Getenv("GOPATH")); len(gopath) > 0 && gopath[0] != "" {
+		return filepath.Join(gopath[0], "pkg", "mod")
+	}
+	return filepath.Join(os.Getenv("HOME"), "go", "pkg", "mod")
+}
+
+// goEnv returns the value of the Go environment variable, either from the
+// environment or from `go env`.
+func goEnv(name string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	out, err := exec.Command("go", "env", name).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// goProxies returns the list of module proxy URLs from $GOPROXY used to
+// download the module. Direct downloads from version control systems are not
+// supported, so private modules and module proxy lists without any proxy
+// before "direct" or "off" are reported as errors.
+func goProxies(mod string) ([]string, error) {
+	private := goEnv("GONOPROXY")
+	if private == "" {
+		private = goEnv("GOPRIVATE")
+	}
+	if matchGlobs(private, mod) {
+		return nil, fmt.Errorf("module %s is private (GOPRIVATE/GONOPROXY) and can not be downloaded from a proxy, run `go mod download %s` to add it to the module cache", mod, mod)
+	}
+	env := goEnv("GOPROXY")
+	if env == "" {
+		env = "https://proxy.golang.org,direct"
+	}
+	proxies := []string{}
+	for _, p := range strings.FieldsFunc(env, func(r rune) bool { return r == ',' || r == '|' }) {
+		if p == "direct" || p == "off" {
+			if len(proxies) == 0 && p == "off" {
+				return nil, fmt.Errorf("module downloads are disabled by GOPROXY=%s", env)
+			} else if len(proxies) == 0 {
+				return nil, fmt.Errorf("direct module downloads are not supported (GOPROXY=%s), run `go mod download %s` to add it to the module cache", env, mod)
+			}
+			break
+		}
+		proxies = append(proxies, strings.TrimSuffix(p, "/"))
+	}
+	return proxies, nil
+}
+
+// matchGlobs returns true if the module path or any of its prefixes matches
+// one of the comma-separated glob patterns, as in $GOPRIVATE.
+func matchGlobs(globs, mod string) bool {
+	for _, glob := range strings.Split(globs, ",") {
+		glob = strings.TrimSuffix(strings.TrimSpace(glob), "/")
+		if glob == "" {
+			continue
+		}
+		elems := strings.Split(mod, "/")
+		n := strings.Count(glob, "/") + 1
+		if n > len(elems) {
+			continue
+		}
+		if ok, _ := path.Match(glob, strings.Join(elems[:n], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fileURLPath returns the local path of the file:// URL, including the ones
+// with a drive letter on Windows, e.g. file:///C:/proxy.
+func fileURLPath(url string) string {
+	p := strings.TrimPrefix(url, "file://")
+	if len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		p = p[1:]
+	}
+	return filepath.FromSlash(p)
+}
+
+// goModSource resolves files inside Go modules.
+type goModSource struct {
+	r *Resolver
+}
+
+// Resolve resolves the file inside a Go module. Modules found in the Go module
+// cache are used as is, otherwise the module zip is downloaded from the module
+// proxy and the proto files from it are unpacked into the cache. Returns the
+// module directory as the include path of directories, the include path of
+// files is derived from their imports.
+func (s goModSource) Resolve(ctx context.Context, ref string) (string, string, error) {
+	mod, version, sub, err := parseGoModRef(ref)
+	if err != nil {
+		return "", "", err
+	}
+	replaced := ""
+	if gomod, err := findGoMod(); err == nil {
+		mod, version, replaced = gomod.replace(mod, version)
+	}
+	escaped := escapeModulePath(mod) + "@" + escapeModulePath(version)
+	dir := filepath.Join(goModCache(), filepath.FromSlash(escaped))
+	if replaced != "" {
+		s.r.log.Debug("Use go.mod replacement:", replaced)
+		dir = replaced
+	} else if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		s.r.log.Debug("Use go module cache:", dir)
+	} else if dir, err = s.downloadGoModZip(ctx, mod, version); err != nil {
+		return "", "", err
+	}
+	local := filepath.Join(dir, filepath.FromSlash(sub))
+	if info, err := os.Stat(local); err != nil {
+		return "", "", &Error{Kind: KindNotFound, Ref: ref, Causes: []error{err}}
+	} else if info.IsDir() {
+		return dir, local, nil
+	}
+	return "", local, nil
+}
+
+func (s goModSource) downloadGoModZip(ctx context.Context, mod, version string) (string, error) {
+	escaped := escapeModulePath(mod) + "@" + escapeModulePath(version)
+	dir := s.r.CacheFile("gomod", filepath.FromSlash(escaped))
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		s.r.log.Debug("Use cached go module:", dir)
+		return dir, nil
+	}
+	if err := os.MkdirAll(s.r.CacheFile("gomod"), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempFile(s.r.CacheFile("gomod"), "download-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	proxies, err := goProxies(mod)
+	if err != nil {
+		return "", err
+	}
+	errs := []error{}
+	downloaded := false
+	for _, proxy := range proxies {
+		url := proxy + "/" + escapeModulePath(mod) + "/@v/" + escapeModulePath(version) + ".zip"
+		s.r.log.Info("Downloading", url)
+		if err := tmp.Truncate(0); err != nil {
+			return "", err
+		}
+		if _, err := tmp.Seek(0, 0); err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(url, "file://") {
+			err = copyFile(tmp, fileURLPath(url))
+			if os.IsNotExist(err) {
+				err = &Error{Kind: KindNotFound, Ref: url, Causes: []error{err}}
+			}
+		} else {
+			err = s.r.DownloadTo(ctx, tmp, url)
+		}
+		if err == nil {
+			downloaded = true
+			break
+		}
+		errs = append(errs, err)
+	}
+	if !downloaded {
+		return "", NewError(mod+"@"+version, errs...)
+	}
+
+	info, err := tmp.Stat()
+	if err != nil {
+		return "", err
+	}
+	zr, err := zip.NewReader(tmp, info.Size())
+	if err != nil {
+		return "", err
+	}
+	unpacked, err := ioutil.TempDir(s.r.CacheFile("gomod"), "unpack-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(unpacked)
+	prefix := mod + "@" + version + "/"
+	for _, zf := range zr.File {
+		if !strings.HasPrefix(zf.Name, prefix) || path.Ext(zf.Name) != ".proto" {
+			continue
+		}
+		src, err := zf.Open()
+		if err != nil {
+			return "", err
+		}
+		err = writeUnpacked(unpacked, strings.TrimPrefix(zf.Name, prefix), src)
+		src.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(unpacked, dir); err != nil {
+		return "", err
+	}
+	s.r.log.Info("Unpacked", mod+"@"+version, "into", dir)
+	return dir, nil
+}
+
+func copyFile(w *os.File, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = w.ReadFrom(f)
+	return err
+}
@@ -0,0 +1,131 @@
+package resolver
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGoMod(t *testing.T) {
+	gomod, err := parseGoMod(bufio.NewScanner(strings.NewReader(`module example.com/foo
+
+go 1.18
+
+require github.com/foo/bar v1.0.0 // indirect
+
+require (
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.18.0
+	// comment
+	github.com/envoyproxy/protoc-gen-validate v1.0.2 // indirect
+)
+
+replace github.com/foo/bar => ../bar
+
+replace (
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.18.0 => github.com/fork/grpc-gateway/v2 v2.18.1
+)
+`)))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"github.com/foo/bar":                        "v1.0.0",
+		"github.com/grpc-ecosystem/grpc-gateway/v2": "v2.18.0",
+		"github.com/envoyproxy/protoc-gen-validate": "v1.0.2",
+	}, gomod.requires)
+
+	gomod.dir = filepath.Join("src", "foo")
+	mod, version, dir := gomod.replace("github.com/foo/bar", "v1.0.0")
+	assert.Equal(t, []string{"github.com/foo/bar", "v1.0.0", filepath.Join("src", "bar")}, []string{mod, version, dir})
+	mod, version, dir = gomod.replace("github.com/grpc-ecosystem/grpc-gateway/v2", "v2.18.0")
+	assert.Equal(t, []string{"github.com/fork/grpc-gateway/v2", "v2.18.1", ""}, []string{mod, version, dir})
+	mod, version, dir = gomod.replace("github.com/grpc-ecosystem/grpc-gateway/v2", "v2.19.0")
+	assert.Equal(t, []string{"github.com/grpc-ecosystem/grpc-gateway/v2", "v2.19.0", ""}, []string{mod, version, dir})
+	assert.Equal(t, "github.com/!burnt!sushi/toml", escapeModulePath("github.com/BurntSushi/toml"))
+}
+
+func TestGoProxies(t *testing.T) {
+	t.Setenv("GONOPROXY", "*.corp.example.com,example.com/private")
+	for _, test := range []struct {
+		Env     string
+		Mod     string
+		Proxies []string
+		Error   string
+	}{
+		{Env: "https://proxy.example.com/,direct", Mod: "example.com/foo", Proxies: []string{"https://proxy.example.com"}},
+		{Env: "https://a.example.com|https://b.example.com,off,https://c.example.com", Mod: "example.com/foo", Proxies: []string{"https://a.example.com", "https://b.example.com"}},
+		{Env: "direct", Mod: "example.com/foo", Error: "direct module downloads are not supported"},
+		{Env: "off", Mod: "example.com/foo", Error: "disabled by GOPROXY=off"},
+		{Env: "https://proxy.example.com", Mod: "git.corp.example.com/foo", Error: "is private"},
+		{Env: "https://proxy.example.com", Mod: "example.com/private/foo", Error: "is private"},
+	} {
+		t.Setenv("GOPROXY", test.Env)
+		proxies, err := goProxies(test.Mod)
+		if test.Error != "" {
+			assert.Error(t, err, test.Env)
+			assert.Contains(t, err.Error(), test.Error)
+		} else {
+			assert.NoError(t, err, test.Env)
+			assert.Equal(t, test.Proxies, proxies)
+		}
+	}
+	assert.Equal(t, filepath.FromSlash("/srv/proxy"), fileURLPath("file:///srv/proxy"))
+	assert.Equal(t, filepath.FromSlash("C:/proxy"), fileURLPath("file:///C:/proxy"))
+}
+
+func TestDownloadGoMod(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	assert.NoError(t, err)
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	r := New(WithCacheDir(filepath.Join(dir, "cache")))
+	t.Setenv("GOMODCACHE", filepath.Join(dir, "gomodcache"))
+	t.Setenv("GOPROXY", "file://"+filepath.ToSlash(filepath.Join(dir, "proxy"))+",off")
+	t.Setenv("GONOPROXY", "none.invalid")
+
+	os.MkdirAll(filepath.Join(dir, "proxy", "example.com", "!foo", "@v"), 0755)
+	f, err := os.Create(filepath.Join(dir, "proxy", "example.com", "!foo", "@v", "v1.0.0.zip"))
+	assert.NoError(t, err)
+	zw := zip.NewWriter(f)
+	for name, content := range map[string]string{
+		"example.com/Foo@v1.0.0/options/annotations.proto": `import "options/openapiv2.proto";`,
+		"example.com/Foo@v1.0.0/options/openapiv2.proto":   `package options;`,
+		"example.com/Foo@v1.0.0/main.go":                   `package main`,
+	} {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	f.Close()
+
+	// Files have no include root of their own, directories are rooted at the
+	// module directory
+	root, local, err := r.ResolveRoot(context.Background(), "gomod://example.com/Foo@v1.0.0/options/annotations.proto")
+	assert.NoError(t, err)
+	assert.Equal(t, "", root)
+	mod := r.CacheFile("gomod", "example.com", "!foo@v1.0.0")
+	assert.Equal(t, filepath.Join(mod, "options", "annotations.proto"), local)
+	root, local, err = r.ResolveRoot(context.Background(), "gomod://example.com/Foo@v1.0.0/options")
+	assert.NoError(t, err)
+	assert.Equal(t, mod, root)
+	assert.Equal(t, filepath.Join(mod, "options"), local)
+	_, err = os.Stat(filepath.Join(mod, "main.go"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, _, err = r.ResolveRoot(context.Background(), "gomod://example.com/Foo@v2.0.0/options/annotations.proto")
+	assert.Error(t, err)
+
+	// Local replacements from go.mod are used as is
+	os.MkdirAll(filepath.Join(dir, "bar", "options"), 0755)
+	os.WriteFile(filepath.Join(dir, "bar", "options", "bar.proto"), []byte(`package options;`), 0644)
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/app\n\nrequire example.com/bar v1.0.0\n\nreplace example.com/bar => ./bar\n"), 0644)
+	_, local, err = r.ResolveRoot(context.Background(), "gomod://example.com/bar/options/bar.proto")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "bar", "options", "bar.proto"), local)
+}
@@ -0,0 +1,45 @@
+package resolver
+
+import "context"
+
+type hgBackend struct {
+	command
+}
+
+type hgRepo struct {
+	hg  *hgBackend
+	dir string
+}
+
+// NewHgBackend returns the Mercurial implementation using the command line hg
+// tool. It uses the authentication configured in hgrc.
+func NewHgBackend(log Logger) Backend {
+	return &hgBackend{command{name: "hg", log: log}}
+}
+
+func (h *hgBackend) Open(ctx context.Context, url, dir string) (Repo, error) {
+	_, err := h.run(ctx, "--cwd", dir, "root")
+	return &hgRepo{hg: h, dir: dir}, err
+}
+
+func (h *hgBackend) RemoteURL(url string) string {
+	return "https://" + url
+}
+
+func (h *hgBackend) Clone(ctx context.Context, url, dir string) (Repo, error) {
+	_, err := h.run(ctx, "clone", "--noupdate", h.RemoteURL(url), dir)
+	return &hgRepo{hg: h, dir: dir}, err
+}
+
+func (r *hgRepo) Checkout(ctx context.Context, rev string) error {
+	if rev == "" || rev == LatestRev {
+		rev = "default"
+	}
+	_, err := r.hg.run(ctx, "--cwd", r.dir, "update", "--clean", "--rev", rev)
+	return err
+}
+
+func (r *hgRepo) Fetch(ctx context.Context) error {
+	_, err := r.hg.run(ctx, "--cwd", r.dir, "pull")
+	return err
+}
@@ -0,0 +1,244 @@
+package resolver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// httpRef is a parsed HTTP(S) reference in a form of
+// `https://host/path/archive.tar.gz//sub/dir/foo.proto#sha256=<hex>`.
+type httpRef struct {
+	url    string // URL of the archive or the raw file
+	sub    string // path inside the archive, empty for raw files and archive roots
+	sha256 string // optional expected checksum of the downloaded content
+}
+
+func isArchive(name string) bool {
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseHTTPRef(ref string) (httpRef, error) {
+	r := httpRef{}
+	if i := strings.Index(ref, "#"); i >= 0 {
+		fragment := ref[i+1:]
+		ref = ref[:i]
+		if !strings.HasPrefix(fragment, "sha256=") {
+			return r, fmt.Errorf("unsupported URL fragment: %s", fragment)
+		}
+		r.sha256 = strings.ToLower(strings.TrimPrefix(fragment, "sha256="))
+		if len(r.sha256) != sha256.Size*2 {
+			return r, fmt.Errorf("malformed sha256 checksum: %s", r.sha256)
+		}
+	}
+	scheme := ref[:strings.Index(ref, "://")+3]
+	rest := strings.TrimPrefix(ref, scheme)
+	if i := strings.Index(rest, "//"); i >= 0 {
+		r.url = scheme + rest[:i]
+		r.sub = path.Clean(rest[i+2:])
+		if r.sub == "." || strings.HasPrefix(r.sub, "../") || r.sub == ".." {
+			return r, fmt.Errorf("invalid path inside archive: %s", rest[i+2:])
+		}
+	} else {
+		r.url = ref
+	}
+	if r.sub != "" && !isArchive(r.url) {
+		return r, fmt.Errorf("not an archive: %s", r.url)
+	}
+	return r, nil
+}
+
+// httpSource resolves raw files and archives served over HTTP(S).
+type httpSource struct {
+	r *Resolver
+}
+
+// Resolve downloads a raw file or an archive referenced by the URL into the
+// cache and unpacks it. Returns a directory to be used as an include path and
+// a local path of the referenced file or directory.
+func (s httpSource) Resolve(ctx context.Context, ref string) (string, string, error) {
+	r, err := parseHTTPRef(ref)
+	if err != nil {
+		return "", "", err
+	}
+	root, err := s.cachedHTTP(ctx, r)
+	if err != nil {
+		return "", "", err
+	}
+	local := root
+	if r.sub != "" {
+		local = filepath.Join(root, filepath.FromSlash(r.sub))
+	} else if !isArchive(r.url) {
+		local = filepath.Join(root, path.Base(r.url))
+	}
+	if _, err := os.Stat(local); err != nil {
+		return "", "", &Error{Kind: KindNotFound, Ref: ref, Causes: []error{err}}
+	}
+	return root, local, nil
+}
+
+// cachedHTTP returns a content-addressed cache directory with the unpacked
+// contents of the URL. The content is downloaded only if the checksum is not
+// known yet, or if there is no cached copy.
+func (s httpSource) cachedHTTP(ctx context.Context, r httpRef) (string, error) {
+	urlSum := sha256.Sum256([]byte(r.url))
+	index := s.r.CacheFile("archives", "urls", hex.EncodeToString(urlSum[:]))
+	sum := r.sha256
+	if sum == "" {
+		if b, err := ioutil.ReadFile(index); err == nil {
+			sum = strings.TrimSpace(string(b))
+		}
+	}
+	if sum != "" {
+		dir := s.r.CacheFile("archives", sum)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			s.r.log.Debug("Use cached archive:", dir)
+			return dir, nil
+		}
+	}
+
+	if err := os.MkdirAll(s.r.CacheFile("archives", "urls"), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempFile(s.r.CacheFile("archives"), "download-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	s.r.log.Info("Downloading", r.url)
+	if err := s.r.DownloadTo(ctx, tmp, r.url); err != nil {
+		return "", err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, tmp); err != nil {
+		return "", err
+	}
+	actual := hex.EncodeToString(h.Sum(nil))
+	if r.sha256 != "" && actual != r.sha256 {
+		return "", &Error{Kind: KindChecksum, Ref: r.url, Causes: []error{fmt.Errorf("got %s, expected %s", actual, r.sha256)}}
+	}
+
+	dir := s.r.CacheFile("archives", actual)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		unpacked, err := ioutil.TempDir(s.r.CacheFile("archives"), "unpack-")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(unpacked)
+		if err := unpack(tmp, r.url, unpacked); err != nil {
+			return "", fmt.Errorf("%s: %w", r.url, err)
+		}
+		if err := os.Rename(unpacked, dir); err != nil {
+			return "", err
+		}
+	}
+	if err := ioutil.WriteFile(index, []byte(actual+"\n"), 0644); err != nil {
+		return "", err
+	}
+	s.r.log.Info("Unpacked", r.url, "into", dir)
+	return dir, nil
+}
+
+// unpack extracts the archive into the directory, or copies the raw file into
+// it if the URL does not look like an archive.
+func unpack(f *os.File, url, dir string) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	switch {
+	case strings.HasSuffix(url, ".zip"):
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		zr, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return err
+		}
+		for _, zf := range zr.File {
+			if zf.FileInfo().IsDir() {
+				continue
+			}
+			src, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			err = writeUnpacked(dir, zf.Name, src)
+			src.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case strings.HasSuffix(url, ".tar.gz"), strings.HasSuffix(url, ".tgz"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return untar(gz, dir)
+	case strings.HasSuffix(url, ".tar"):
+		return untar(f, dir)
+	default:
+		return writeUnpacked(dir, path.Base(url), f)
+	}
+}
+
+func untar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := writeUnpacked(dir, hdr.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// writeUnpacked writes a single archive entry, refusing entries that would
+// end up outside of the target directory.
+func writeUnpacked(dir, name string, r io.Reader) error {
+	name = path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))[1:]
+	if name == "" {
+		return errors.New("empty file name in archive")
+	}
+	dst := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, r)
+	return err
+}
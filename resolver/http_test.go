@@ -0,0 +1,89 @@
+package resolver
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHTTPRef(t *testing.T) {
+	for _, test := range []struct {
+		Ref string
+		URL string
+		Sub string
+		Sum string
+		Err bool
+	}{
+		{Ref: "https://example.com/foo.proto", URL: "https://example.com/foo.proto"},
+		{Ref: "https://example.com/a-1.2.tar.gz//sub/dir/foo.proto", URL: "https://example.com/a-1.2.tar.gz", Sub: "sub/dir/foo.proto"},
+		{Ref: "http://example.com/a.zip//foo.proto#sha256=" + fmt.Sprintf("%064d", 0), URL: "http://example.com/a.zip", Sub: "foo.proto", Sum: fmt.Sprintf("%064d", 0)},
+		{Ref: "https://example.com/a.zip//../foo.proto", Err: true},
+		{Ref: "https://example.com/foo.proto//bar.proto", Err: true},
+		{Ref: "https://example.com/foo.proto#md5=1234", Err: true},
+	} {
+		r, err := parseHTTPRef(test.Ref)
+		if test.Err {
+			assert.Error(t, err, test.Ref)
+			continue
+		}
+		assert.NoError(t, err, test.Ref)
+		assert.Equal(t, httpRef{url: test.URL, sub: test.Sub, sha256: test.Sum}, r)
+	}
+}
+
+func TestDownloadHTTP(t *testing.T) {
+	r := New(WithCacheDir(t.TempDir()))
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	proto := []byte(`syntax = "proto3";`)
+	tw.WriteHeader(&tar.Header{Name: "contracts/v1/foo.proto", Mode: 0644, Size: int64(len(proto)), Typeflag: tar.TypeReg})
+	tw.Write(proto)
+	tw.Close()
+	gz.Close()
+	archive := buf.Bytes()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		switch req.URL.Path {
+		case "/contracts-1.0.tar.gz":
+			w.Write(archive)
+		case "/raw/bar.proto":
+			w.Write(proto)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	sum := fmt.Sprintf("%x", sha256.Sum256(archive))
+	root, local, err := r.ResolveRoot(context.Background(), server.URL+"/contracts-1.0.tar.gz//contracts/v1/foo.proto#sha256="+sum)
+	assert.NoError(t, err)
+	assert.Equal(t, r.CacheFile("archives", sum), root)
+	assert.Equal(t, filepath.Join(root, "contracts", "v1", "foo.proto"), local)
+
+	// Cached archive is used without downloading it again
+	_, _, err = r.ResolveRoot(context.Background(), server.URL+"/contracts-1.0.tar.gz//contracts/v1/foo.proto")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requests)
+
+	root, local, err = r.ResolveRoot(context.Background(), server.URL+"/raw/bar.proto")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "bar.proto"), local)
+
+	_, _, err = r.ResolveRoot(context.Background(), server.URL+"/raw/bar.proto#sha256="+fmt.Sprintf("%064d", 0))
+	assert.Error(t, err)
+	_, _, err = r.ResolveRoot(context.Background(), server.URL+"/missing.zip")
+	assert.Error(t, err)
+}
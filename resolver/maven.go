@@ -0,0 +1,172 @@
+package resolver
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	mavenScheme            = "maven://"
+	defaultMavenRepository = "https://repo1.maven.org/maven2"
+)
+
+// mavenRef is a parsed Maven artifact reference in a form of
+// `maven://group:artifact:version[:classifier][//path/inside/jar]`, e.g.
+// `maven://com.example:payments-proto:1.4.0//payments/v1/api.proto`.
+type mavenRef struct {
+	group, artifact, version, classifier string
+	sub                                  string
+}
+
+func parseMavenRef(ref string) (mavenRef, error) {
+	r := mavenRef{}
+	coords := strings.TrimPrefix(ref, mavenScheme)
+	if i := strings.Index(coords, "//"); i >= 0 {
+		r.sub = path.Clean(coords[i+2:])
+		coords = coords[:i]
+		if r.sub == "." || r.sub == ".." || strings.HasPrefix(r.sub, "../") {
+			return r, fmt.Errorf("invalid path inside artifact: %s", ref)
+		}
+	}
+	parts := strings.Split(coords, ":")
+	if len(parts) < 3 || len(parts) > 4 {
+		return r, fmt.Errorf("malformed maven coordinates: %s", coords)
+	}
+	for _, p := range parts {
+		if p == "" || strings.Contains(p, "/") {
+			return r, fmt.Errorf("malformed maven coordinates: %s", coords)
+		}
+	}
+	r.group, r.artifact, r.version = parts[0], parts[1], parts[2]
+	if len(parts) == 4 {
+		r.classifier = parts[3]
+	}
+	return r, nil
+}
+
+// jarPath returns a path to the artifact jar relative to the repository root.
+func (r mavenRef) jarPath() string {
+	return r.unpackedPath() + ".jar"
+}
+
+// unpackedPath returns a path to the unpacked artifact relative to the cache.
+// It is named after the jar, so that the classified artifacts of the same
+// version are unpacked into sibling directories.
+func (r mavenRef) unpackedPath() string {
+	name := r.artifact + "-" + r.version
+	if r.classifier != "" {
+		name = name + "-" + r.classifier
+	}
+	return path.Join(strings.ReplaceAll(r.group, ".", "/"), r.artifact, r.version, name)
+}
+
+// mavenSource resolves the proto files packaged into Maven artifacts.
+type mavenSource struct {
+	r *Resolver
+}
+
+// Resolve resolves the proto files packaged into a Maven artifact. The jar is
+// taken from the local ~/.m2 repository if present, or downloaded from the
+// remote repository. The proto entries are unpacked into the cache. Returns
+// an include path and a local path of the referenced file or directory.
+func (s mavenSource) Resolve(ctx context.Context, ref string) (string, string, error) {
+	r, err := parseMavenRef(ref)
+	if err != nil {
+		return "", "", err
+	}
+	dir := s.r.CacheFile("maven", filepath.FromSlash(r.unpackedPath()))
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		s.r.log.Debug("Use cached maven artifact:", dir)
+	} else if err := s.unpackMaven(ctx, r, dir); err != nil {
+		return "", "", err
+	}
+	local := dir
+	if r.sub != "" {
+		local = filepath.Join(dir, filepath.FromSlash(r.sub))
+	}
+	if _, err := os.Stat(local); err != nil {
+		return "", "", &Error{Kind: KindNotFound, Ref: ref, Causes: []error{err}}
+	}
+	return dir, local, nil
+}
+
+func (s mavenSource) unpackMaven(ctx context.Context, r mavenRef, dir string) error {
+	jar := filepath.Join(os.Getenv("HOME"), ".m2", "repository", filepath.FromSlash(r.jarPath()))
+	if _, err := os.Stat(jar); err == nil {
+		s.r.log.Debug("Use local maven artifact:", jar)
+	} else {
+		if err := os.MkdirAll(s.r.CacheFile("maven"), 0755); err != nil {
+			return err
+		}
+		tmp, err := ioutil.TempFile(s.r.CacheFile("maven"), "download-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		url := strings.TrimSuffix(s.r.mavenRepo, "/") + "/" + r.jarPath()
+		s.r.log.Info("Downloading", url)
+		if err := s.r.DownloadTo(ctx, tmp, url); err != nil {
+			return fmt.Errorf("%s: %w", url, err)
+		}
+		// Maven repositories publish SHA-1 checksums next to the artifacts
+		var cksum bytes.Buffer
+		if err := s.r.DownloadTo(ctx, &cksum, url+".sha1"); KindOf(err) == KindNotFound {
+			s.r.log.Warn("No checksum published for", url, "the artifact is not verified")
+		} else if err != nil {
+			return fmt.Errorf("%s.sha1: %w", url, err)
+		} else {
+			if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			h := sha1.New()
+			if _, err := io.Copy(h, tmp); err != nil {
+				return err
+			}
+			expected := strings.Fields(cksum.String() + " ")[0]
+			if actual := fmt.Sprintf("%x", h.Sum(nil)); actual != expected {
+				return &Error{Kind: KindChecksum, Ref: url, Causes: []error{fmt.Errorf("got %s, expected %s", actual, expected)}}
+			}
+		}
+		jar = tmp.Name()
+	}
+
+	zr, err := zip.OpenReader(jar)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+	unpacked, err := ioutil.TempDir(filepath.Dir(dir), "unpack-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(unpacked)
+	for _, zf := range zr.File {
+		if path.Ext(zf.Name) != ".proto" {
+			continue
+		}
+		src, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = writeUnpacked(unpacked, zf.Name, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return os.Rename(unpacked, dir)
+}
@@ -0,0 +1,90 @@
+package resolver
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMavenRef(t *testing.T) {
+	r, err := parseMavenRef("maven://com.example:payments-proto:1.4.0//payments/v1/api.proto")
+	assert.NoError(t, err)
+	assert.Equal(t, mavenRef{group: "com.example", artifact: "payments-proto", version: "1.4.0", sub: "payments/v1/api.proto"}, r)
+	assert.Equal(t, "com/example/payments-proto/1.4.0/payments-proto-1.4.0.jar", r.jarPath())
+
+	r, err = parseMavenRef("maven://com.example:payments:1.4.0:proto")
+	assert.NoError(t, err)
+	assert.Equal(t, "com/example/payments/1.4.0/payments-1.4.0-proto.jar", r.jarPath())
+
+	for _, ref := range []string{"maven://com.example:payments", "maven://com.example::1.0", "maven://a:b:c//../foo.proto"} {
+		_, err := parseMavenRef(ref)
+		assert.Error(t, err, ref)
+	}
+}
+
+func TestDownloadMaven(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"payments/v1/api.proto", "META-INF/MANIFEST.MF"} {
+		w, _ := zw.Create(name)
+		w.Write([]byte(name))
+	}
+	zw.Close()
+	jar := buf.Bytes()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/repo/com/example/payments-proto/1.4.0/payments-proto-1.4.0.jar":
+			w.Write(jar)
+		case "/repo/com/example/payments-proto/1.4.0/payments-proto-1.4.0.jar.sha1":
+			fmt.Fprintf(w, "%x", sha1.Sum(jar))
+		case "/repo/com/example/payments-proto/1.4.0/payments-proto-1.4.0-grpc.jar",
+			"/repo/com/example/payments-proto/1.6.0/payments-proto-1.6.0.jar":
+			w.Write(jar)
+		case "/repo/com/example/payments-proto/1.4.0/payments-proto-1.4.0-grpc.jar.sha1":
+			fmt.Fprintf(w, "%x", sha1.Sum(jar))
+		case "/repo/com/example/payments-proto/1.5.0/payments-proto-1.5.0.jar":
+			w.Write(jar)
+		case "/repo/com/example/payments-proto/1.5.0/payments-proto-1.5.0.jar.sha1":
+			fmt.Fprint(w, "0000000000000000000000000000000000000000")
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+	r := New(WithCacheDir(filepath.Join(dir, "cache")), WithMavenRepository(server.URL+"/repo/"))
+
+	root, local, err := r.ResolveRoot(context.Background(), "maven://com.example:payments-proto:1.4.0//payments/v1/api.proto")
+	assert.NoError(t, err)
+	assert.Equal(t, r.CacheFile("maven", "com", "example", "payments-proto", "1.4.0", "payments-proto-1.4.0"), root)
+	assert.Equal(t, filepath.Join(root, "payments", "v1", "api.proto"), local)
+	_, err = os.Stat(filepath.Join(root, "META-INF"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Classified artifacts are unpacked next to the unclassified one
+	root, _, err = r.ResolveRoot(context.Background(), "maven://com.example:payments-proto:1.4.0:grpc")
+	assert.NoError(t, err)
+	assert.Equal(t, r.CacheFile("maven", "com", "example", "payments-proto", "1.4.0", "payments-proto-1.4.0-grpc"), root)
+	_, _, err = r.ResolveRoot(context.Background(), "maven://com.example:payments-proto:1.4.0//payments/v1/api.proto")
+	assert.NoError(t, err)
+
+	_, _, err = r.ResolveRoot(context.Background(), "maven://com.example:payments-proto:1.5.0")
+	assert.Error(t, err)
+	// Artifacts without published checksums are used with a warning
+	_, _, err = r.ResolveRoot(context.Background(), "maven://com.example:payments-proto:1.6.0")
+	assert.NoError(t, err)
+	_, _, err = r.ResolveRoot(context.Background(), "maven://com.example:payments-proto:2.0.0")
+	assert.Error(t, err)
+}
@@ -1,9 +1,11 @@
-package main
+package resolver
 
 import (
 	"bufio"
 	"bytes"
 	"io"
+	"os"
+	"path/filepath"
 )
 
 func netrc(r io.Reader, machine string) (username, password string, err error) {
@@ -49,3 +51,21 @@ func netrc(r io.Reader, machine string) (username, password string, err error) {
 	}
 	return username, password, scanner.Err()
 }
+
+// Auth returns the credentials for the host. Empty username and password
+// mean anonymous access.
+type Auth func(host string) (username, password string)
+
+// NetrcAuth reads the credentials for the host from $HOME/.netrc.
+func NetrcAuth(host string) (username, password string) {
+	f, err := os.Open(filepath.Join(os.Getenv("HOME"), ".netrc"))
+	if err != nil {
+		return "", ""
+	}
+	defer f.Close()
+	username, password, err = netrc(f, host)
+	if err != nil {
+		return "", ""
+	}
+	return username, password
+}
@@ -0,0 +1,258 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+)
+
+const (
+	protoBinariesBaseURL        = "https://repo1.maven.org/maven2/com/google/protobuf/protoc"
+	includesCacheFilePermission = 0664
+	includesCacheDirPermission  = 0775
+)
+
+var platforms = map[string]string{
+	"linux_386":     "linux-x86_32",
+	"linux_amd64":   "linux-x86_64",
+	"linux_arm64":   "linux-aarch_64",
+	"darwin_amd64":  "osx-x86_64",
+	"darwin_arm64":  "osx-aarch_64",
+	"windows_386":   "windows-x86_32",
+	"windows_amd64": "windows-x86_64",
+}
+
+// Get sends a GET request using the credentials of the resolver for the host,
+// if any.
+func (r *Resolver) Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.auth != nil {
+		if username, password := r.auth(req.URL.Hostname()); username != "" || password != "" {
+			req.SetBasicAuth(username, password)
+		}
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func (r *Resolver) download(ctx context.Context, url string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := r.DownloadTo(ctx, &buf, url)
+	return buf.Bytes(), err
+}
+
+// DownloadTo writes the contents of the URL to w.
+func (r *Resolver) DownloadTo(ctx context.Context, w io.Writer, url string) error {
+	res, err := r.Get(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		e := &Error{Kind: KindNetwork, Ref: url, Causes: []error{fmt.Errorf("bad status: %s", res.Status)}}
+		switch res.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			e.Kind = KindAuth
+		case http.StatusNotFound, http.StatusGone:
+			e.Kind = KindNotFound
+		}
+		return e
+	}
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+// Platforms returns the sorted GOOS_GOARCH names of the platforms with
+// protoc binaries, e.g. "linux_arm64".
+func Platforms() []string {
+	names := make([]string, 0, len(platforms))
+	for name := range platforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DownloadProtoc downloads the protoc binary of the version for the current
+// platform into the cache, unless it is already there. Returns the absolute
+// path to the protoc binary.
+func (r *Resolver) DownloadProtoc(ctx context.Context, version string) (string, error) {
+	return r.DownloadProtocFor(ctx, version, runtime.GOOS+"_"+runtime.GOARCH)
+}
+
+// ProtocPath returns the path of the protoc binary of the version for the
+// GOOS_GOARCH platform in the cache, whether it is downloaded or not.
+func (r *Resolver) ProtocPath(version, platform string) string {
+	return r.CacheFile(fmt.Sprintf("protoc-%s-%s.exe", version, platform))
+}
+
+// DownloadProtocFor is DownloadProtoc for the GOOS_GOARCH platform, which
+// may differ from the current one, e.g. to prepare a cache for other
+// machines. The binary is verified but never executed.
+func (r *Resolver) DownloadProtocFor(ctx context.Context, version, platform string) (string, error) {
+	url, err := protocURL(version, platform)
+	if err != nil {
+		return "", err
+	}
+
+	protocExePath := r.ProtocPath(version, platform)
+	protocExeName := filepath.Base(protocExePath)
+
+	if _, err := os.Stat(protocExePath); err == nil {
+		return protocExePath, nil
+	}
+
+	r.log.Info("saving protoc to path: ", protocExePath)
+
+	if err := os.MkdirAll(filepath.Dir(protocExePath), 0755); err != nil {
+		return "", err
+	}
+	// The binary is downloaded into a temporary file, so that an interrupted
+	// or failed download never leaves a partial binary in the cache
+	out, err := ioutil.TempFile(filepath.Dir(protocExePath), protocExeName+".download-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(out.Name())
+	err = r.DownloadTo(ctx, out, url)
+	out.Close()
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chmod(out.Name(), 0755); err != nil {
+		return "", err
+	}
+	cksum, err := r.download(ctx, url+".md5")
+	if err != nil {
+		return "", err
+	}
+	if err := verifyMD5(out.Name(), string(cksum), url); err != nil {
+		return "", err
+	}
+	// The published checksum is kept next to the binary, so that the cached
+	// binary can be verified again without downloading anything
+	if err := writeFile(protocExePath+".md5", cksum, 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(out.Name(), protocExePath); err != nil {
+		return "", err
+	}
+	return protocExePath, nil
+}
+
+// VerifyProtocFor checks the cached protoc binary of the version for the
+// GOOS_GOARCH platform against its published md5 checksum. The checksum saved
+// with the binary is used, if any, otherwise it is downloaded. Returns an
+// error of KindChecksum if the binary does not match.
+func (r *Resolver) VerifyProtocFor(ctx context.Context, version, platform string) error {
+	url, err := protocURL(version, platform)
+	if err != nil {
+		return err
+	}
+	protocExePath := r.ProtocPath(version, platform)
+	cksum, err := ioutil.ReadFile(protocExePath + ".md5")
+	if os.IsNotExist(err) {
+		cksum, err = r.download(ctx, url+".md5")
+	}
+	if err != nil {
+		return err
+	}
+	return verifyMD5(protocExePath, string(cksum), protocExePath)
+}
+
+// protocURL returns the download URL of the protoc binary of the version for
+// the GOOS_GOARCH platform.
+func protocURL(version, platform string) (string, error) {
+	arch, ok := platforms[platform]
+	if !ok {
+		return "", fmt.Errorf("unable to resolve architecture for %s", platform)
+	}
+	return fmt.Sprintf("%[1]s/%[2]s/protoc-%[2]s-%[3]s.exe", protoBinariesBaseURL, version, arch), nil
+}
+
+// verifyMD5 compares the md5 checksum of the file with the expected one, the
+// mismatch is reported for the reference.
+func verifyMD5(name, cksum, ref string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if s := fmt.Sprintf("%x", h.Sum(nil)); s != cksum {
+		return &Error{Kind: KindChecksum, Ref: ref, Causes: []error{fmt.Errorf("got %s, expected %s", s, cksum)}}
+	}
+	return nil
+}
+
+// CopyIncludes copies the directory tree of the file system into the same
+// directory of the cache, and returns the path to the copy. Files that are
+// already present are not overwritten.
+func (r *Resolver) CopyIncludes(fsys fs.FS, dir string) (string, error) {
+	dst := r.CacheFile(filepath.FromSlash(dir))
+	if err := os.MkdirAll(dst, includesCacheDirPermission); err != nil {
+		return "", err
+	}
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return "", err
+	}
+	for _, fd := range entries {
+		if fd.IsDir() {
+			if _, err := r.CopyIncludes(fsys, path.Join(dir, fd.Name())); err != nil {
+				return "", err
+			}
+			continue
+		}
+		dstfp := filepath.Join(dst, fd.Name())
+		if _, err := os.Stat(dstfp); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, fd.Name()))
+		if err != nil {
+			return "", err
+		}
+		if err := writeFile(dstfp, b, includesCacheFilePermission); err != nil {
+			return "", err
+		}
+	}
+	return dst, nil
+}
+
+// writeFile writes the data to a temporary file renamed to the name, so that
+// an interrupted write never leaves a truncated file behind.
+func writeFile(name string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
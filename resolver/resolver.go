@@ -0,0 +1,180 @@
+// Package resolver fetches proto files from remote repositories into a
+// local cache, and downloads protoc binaries and their standard includes.
+//
+// It is the library behind the protoc wrapper command, and can be used by
+// other tools that need a proto file at a given revision:
+//
+//	r := resolver.New(resolver.WithCacheDir("/tmp/protoc"))
+//	local, err := r.Resolve(ctx, "github.com/googleapis/googleapis/google/api/http.proto@master")
+package resolver
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ProtocVersion is the protoc version of the wrapper, which the default cache
+// directory is named after. Keep it in sync with the go:generate statement in
+// the wrapper's main.go.
+const ProtocVersion = "3.22.2"
+
+// LatestRev is a special revision that invalidates the cached repository and
+// clones it again.
+const LatestRev = "latest"
+
+// Logger receives the progress messages of the resolver.
+type Logger interface {
+	Debug(v ...interface{})
+	Info(v ...interface{})
+	Warn(v ...interface{})
+	Error(v ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(v ...interface{}) {}
+func (nopLogger) Info(v ...interface{})  {}
+func (nopLogger) Warn(v ...interface{})  {}
+func (nopLogger) Error(v ...interface{}) {}
+
+// Resolver resolves remote references into local paths in its cache
+// directory. It is safe to use from multiple goroutines as long as they do
+// not resolve references from the same repository at the same time.
+type Resolver struct {
+	cacheDir      string
+	backend       Backend
+	defaultSource string
+	routes        map[string]string
+	auth          Auth
+	log           Logger
+	mavenRepo     string
+}
+
+// Option configures a Resolver.
+type Option func(*Resolver)
+
+// WithCacheDir sets the cache directory, "protoc/<ProtocVersion>" in
+// DefaultCacheDir() by default, the one used by the wrapper.
+func WithCacheDir(dir string) Option {
+	return func(r *Resolver) { r.cacheDir = dir }
+}
+
+// WithBackend sets the git implementation of the default source, overriding
+// the registered source.
+func WithBackend(b Backend) Option {
+	return func(r *Resolver) { r.backend = b }
+}
+
+// WithDefaultSource sets the registered source used for references that
+// match no route, "git" by default.
+func WithDefaultSource(name string) Option {
+	return func(r *Resolver) { r.defaultSource = name }
+}
+
+// WithRoute routes the references matching the prefix to the registered
+// source. The prefix is either a URL scheme, e.g. "file://", or a host and
+// path prefix, e.g. "hg.example.com". The longest matching prefix wins.
+func WithRoute(prefix, source string) Option {
+	return func(r *Resolver) { r.routes[prefix] = source }
+}
+
+// WithAuth sets the credentials provider for HTTP downloads and git
+// backends that support it, NetrcAuth by default.
+func WithAuth(auth Auth) Option {
+	return func(r *Resolver) { r.auth = auth }
+}
+
+// WithMavenRepository sets the URL of the remote repository Maven artifacts
+// are downloaded from, Maven Central by default.
+func WithMavenRepository(url string) Option {
+	return func(r *Resolver) { r.mavenRepo = url }
+}
+
+// WithLogger sets the logger, messages are discarded by default.
+func WithLogger(log Logger) Option {
+	return func(r *Resolver) { r.log = log }
+}
+
+// New creates a Resolver with the given options.
+func New(opts ...Option) *Resolver {
+	r := &Resolver{
+		defaultSource: "git",
+		routes: map[string]string{
+			"file://":   "local",
+			"http://":   "http",
+			"https://":  "http",
+			goModScheme: "gomod",
+			mavenScheme: "maven",
+		},
+		auth:      NetrcAuth,
+		log:       nopLogger{},
+		mavenRepo: defaultMavenRepository,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.cacheDir == "" {
+		r.cacheDir = filepath.Join(DefaultCacheDir(), "protoc", ProtocVersion)
+	}
+	return r
+}
+
+// DefaultCacheDir returns a path to the local user cache using XDG base
+// directory specification or OS standard directories. It can be overridden
+// with $PROTOC_CACHE_DIR.
+func DefaultCacheDir() string {
+	if dir := os.Getenv("PROTOC_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return os.Getenv("HOME") + "/Library/Caches"
+	case "windows":
+		return os.Getenv("LOCALAPPDATA")
+	case "linux":
+		if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+			return dir
+		}
+		return filepath.Join(os.Getenv("HOME"), ".cache")
+	}
+	return ""
+}
+
+// CacheFile returns a path to the file inside the cache directory.
+func (r *Resolver) CacheFile(path ...string) string {
+	return filepath.Join(append([]string{r.cacheDir}, path...)...)
+}
+
+// SplitRev splits a remote URL into a cleaned path and a revision.
+func SplitRev(url string) (string, string) {
+	url = path.Clean(url)
+	rev := ""
+	if i := strings.LastIndex(url, "@"); i >= 0 {
+		rev = url[i+1:]
+		url = url[:i]
+	}
+	return url, rev
+}
+
+// Resolve resolves the remote reference with the source selected by the
+// routes and returns the local path of the referenced file or directory. By
+// default, references "host/path/to/repo/file.proto[@rev]" are cloned with
+// git and the default branch is used if no revision is given.
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	_, local, err := r.ResolveRoot(ctx, ref)
+	return local, err
+}
+
+// ResolveRoot is Resolve that also returns the include root provided by the
+// source, or an empty string if the source has none, see Source.
+func (r *Resolver) ResolveRoot(ctx context.Context, ref string) (string, string, error) {
+	s, err := r.source(ref)
+	if err != nil {
+		return "", "", err
+	}
+	return s.Resolve(ctx, ref)
+}
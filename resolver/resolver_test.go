@@ -0,0 +1,148 @@
+package resolver
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeBackend struct {
+	cloned    []string
+	checkouts []string
+}
+
+type fakeRepo struct {
+	backend *fakeBackend
+}
+
+func (b *fakeBackend) Open(ctx context.Context, url, dir string) (Repo, error) {
+	return &fakeRepo{backend: b}, nil
+}
+
+func (b *fakeBackend) Clone(ctx context.Context, url, dir string) (Repo, error) {
+	if url != "example.com/org/repo" {
+		return nil, errors.New("not found")
+	}
+	b.cloned = append(b.cloned, url)
+	return &fakeRepo{backend: b}, os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+}
+
+func (r *fakeRepo) Checkout(ctx context.Context, rev string) error {
+	r.backend.checkouts = append(r.backend.checkouts, rev)
+	return ctx.Err()
+}
+
+func (r *fakeRepo) Fetch(ctx context.Context) error {
+	return nil
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	backend := &fakeBackend{}
+	r := New(WithCacheDir(dir), WithBackend(backend))
+
+	local, err := r.Resolve(context.Background(), "example.com/org/repo/api/foo.proto@v1.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "repos", "example.com", "org", "repo", "api", "foo.proto"), local)
+	assert.Equal(t, []string{"example.com/org/repo"}, backend.cloned)
+
+	// Cached repository is reused
+	_, err = r.Resolve(context.Background(), "example.com/org/repo/api/bar.proto")
+	assert.NoError(t, err)
+	assert.Len(t, backend.cloned, 1)
+	assert.Equal(t, []string{"v1.0.0", ""}, backend.checkouts)
+
+	_, err = r.Resolve(context.Background(), "example.com/other/foo.proto")
+	assert.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = r.Resolve(ctx, "example.com/org/repo/api/foo.proto")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSplitRev(t *testing.T) {
+	url, rev := SplitRev("github.com/org/repo/./foo.proto@v1")
+	assert.Equal(t, "github.com/org/repo/foo.proto", url)
+	assert.Equal(t, "v1", rev)
+	url, rev = SplitRev("github.com/org/repo")
+	assert.Equal(t, "github.com/org/repo", url)
+	assert.Equal(t, "", rev)
+}
+
+func TestDefaultCacheDir(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PROTOC_CACHE_DIR", dir)
+	assert.Equal(t, filepath.Join(dir, "protoc", ProtocVersion, "repos"), New().CacheFile("repos"))
+	assert.Equal(t, filepath.Join(dir, "repos"), New(WithCacheDir(dir)).CacheFile("repos"))
+}
+
+func TestCopyIncludes(t *testing.T) {
+	dir := t.TempDir()
+	r := New(WithCacheDir(dir))
+	fsys := fstest.MapFS{
+		"include/google/protobuf/empty.proto": {Data: []byte("new")},
+		"include/google/protobuf/any.proto":   {Data: []byte("any")},
+	}
+	os.MkdirAll(filepath.Join(dir, "include", "google", "protobuf"), 0755)
+	os.WriteFile(filepath.Join(dir, "include", "google", "protobuf", "empty.proto"), []byte("old"), 0644)
+
+	dst, err := r.CopyIncludes(fsys, "include")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "include"), dst)
+	b, _ := os.ReadFile(filepath.Join(dst, "google", "protobuf", "empty.proto"))
+	assert.Equal(t, "old", string(b))
+	b, _ = os.ReadFile(filepath.Join(dst, "google", "protobuf", "any.proto"))
+	assert.Equal(t, "any", string(b))
+}
+
+type interruptedBackend struct {
+	fakeBackend
+}
+
+func (b *interruptedBackend) Clone(ctx context.Context, url, dir string) (Repo, error) {
+	if err := os.MkdirAll(filepath.Join(dir, ".git"), 0755); err != nil {
+		return nil, err
+	}
+	return nil, ctx.Err()
+}
+
+func TestResolveInterruptedClone(t *testing.T) {
+	dir := t.TempDir()
+	r := New(WithCacheDir(dir), WithBackend(&interruptedBackend{}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := r.Resolve(ctx, "github.com/org/repo/foo.proto")
+	assert.ErrorIs(t, err, context.Canceled)
+	entries, err := os.ReadDir(filepath.Join(dir, "repos", "github.com", "org"))
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestDownloadProtocFor(t *testing.T) {
+	assert.Contains(t, Platforms(), "linux_arm64")
+	assert.Contains(t, Platforms(), "darwin_arm64")
+	_, err := New(WithCacheDir(t.TempDir())).DownloadProtocFor(context.Background(), "3.22.2", "plan9_386")
+	assert.Error(t, err)
+}
+
+func TestVerifyProtocFor(t *testing.T) {
+	r := New(WithCacheDir(t.TempDir()))
+	exe := r.ProtocPath("3.22.2", "linux_arm64")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(exe), 0755))
+	assert.NoError(t, os.WriteFile(exe, []byte("protoc"), 0755))
+	assert.NoError(t, os.WriteFile(exe+".md5", []byte(fmt.Sprintf("%x", md5.Sum([]byte("protoc")))), 0644))
+	assert.NoError(t, r.VerifyProtocFor(context.Background(), "3.22.2", "linux_arm64"))
+
+	assert.NoError(t, os.WriteFile(exe, nil, 0755))
+	err := r.VerifyProtocFor(context.Background(), "3.22.2", "linux_arm64")
+	assert.Equal(t, KindChecksum, KindOf(err))
+	assert.Error(t, r.VerifyProtocFor(context.Background(), "3.22.2", "plan9_386"))
+}
@@ -0,0 +1,290 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Source resolves references of one kind, e.g. git repositories or HTTP
+// archives, into local paths in the cache.
+type Source interface {
+	// Resolve returns the include root and the local path of the referenced
+	// file or directory. An empty root means that the source has no include
+	// root of its own and the caller derives it from the reference.
+	Resolve(ctx context.Context, ref string) (root, local string, err error)
+}
+
+// SourceFactory creates a source for the resolver, which provides the cache
+// directory, credentials and logger.
+type SourceFactory func(r *Resolver) Source
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = map[string]SourceFactory{}
+)
+
+func init() {
+	RegisterSource("git", func(r *Resolver) Source {
+		return NewRepoSource(r, NewCmdGitBackend(r.log), ".git")
+	})
+	RegisterSource("go-git", func(r *Resolver) Source {
+		return NewRepoSource(r, NewGoGitBackend(r.log, r.auth), ".git")
+	})
+	RegisterSource("hg", func(r *Resolver) Source {
+		return NewRepoSource(r, NewHgBackend(r.log), ".hg")
+	})
+	RegisterSource("local", func(r *Resolver) Source {
+		return localSource{}
+	})
+	RegisterSource("http", func(r *Resolver) Source {
+		return httpSource{r}
+	})
+	RegisterSource("gomod", func(r *Resolver) Source {
+		return goModSource{r}
+	})
+	RegisterSource("maven", func(r *Resolver) Source {
+		return mavenSource{r}
+	})
+}
+
+// RegisterSource makes the source available by name to all resolvers. It
+// panics if the name is already registered.
+func RegisterSource(name string, factory SourceFactory) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	if _, ok := sources[name]; ok {
+		panic("resolver: source registered twice: " + name)
+	}
+	sources[name] = factory
+}
+
+// SourceNames returns the sorted names of the registered sources.
+func SourceNames() []string {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// matchRoute reports whether the route matches the reference. Routes ending
+// with "://" match URL schemes, other routes match host and path prefixes on
+// a path element boundary, e.g. "hg.example.com" or "github.com/org".
+func matchRoute(route, ref string) bool {
+	if strings.HasSuffix(route, "://") {
+		return strings.HasPrefix(ref, route)
+	}
+	route = strings.TrimSuffix(route, "/")
+	if !strings.HasPrefix(ref, route) {
+		return false
+	}
+	return len(ref) == len(route) || ref[len(route)] == '/' || ref[len(route)] == '@'
+}
+
+// SourceFor returns the name of the source that handles the reference: the
+// source of the longest matching route, or the default source.
+func (r *Resolver) SourceFor(ref string) string {
+	name, best := r.defaultSource, ""
+	for route, source := range r.routes {
+		if len(route) > len(best) && matchRoute(route, ref) {
+			name, best = source, route
+		}
+	}
+	return name
+}
+
+func (r *Resolver) source(ref string) (Source, error) {
+	name := r.SourceFor(ref)
+	if name == r.defaultSource && r.backend != nil {
+		return NewRepoSource(r, r.backend, ".git"), nil
+	}
+	sourcesMu.RLock()
+	factory, ok := sources[name]
+	sourcesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q for %s", name, ref)
+	}
+	return factory(r), nil
+}
+
+// CloneURL returns the remote URL the repository is cloned from by the source
+// of the reference, or an empty string if the source does not clone
+// repositories.
+func (r *Resolver) CloneURL(repo string) string {
+	s, err := r.source(repo)
+	if err != nil {
+		return ""
+	}
+	if rs, ok := s.(*repoSource); ok {
+		if u, ok := rs.backend.(RemoteURLer); ok {
+			return u.RemoteURL(repo)
+		}
+	}
+	return ""
+}
+
+// localSource resolves "file://" URLs to paths on the local filesystem. The
+// directory of the file is its include root.
+type localSource struct{}
+
+func (localSource) Resolve(ctx context.Context, ref string) (string, string, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", "", err
+	}
+	local := filepath.FromSlash(u.Host + u.Path)
+	info, err := os.Stat(local)
+	if err != nil {
+		return "", "", err
+	}
+	if info.IsDir() {
+		return local, local, nil
+	}
+	return filepath.Dir(local), local, nil
+}
+
+type repoSource struct {
+	r       *Resolver
+	backend Backend
+	marker  string
+}
+
+// NewRepoSource returns a source that clones the repositories of remote
+// references "host/path/to/repo/file.proto[@rev]" into the cache using the
+// version control backend. Cached repositories are recognized by the marker
+// directory, e.g. ".git".
+func NewRepoSource(r *Resolver, backend Backend, marker string) Source {
+	return &repoSource{r: r, backend: backend, marker: marker}
+}
+
+func (s *repoSource) Resolve(ctx context.Context, ref string) (string, string, error) {
+	url, rev := SplitRev(ref)
+	repo, dir, local, err := s.openRepo(ctx, url)
+	if err == nil && rev == LatestRev {
+		s.r.log.Debug("Invalidate cached directory:", dir)
+		os.RemoveAll(dir)
+	}
+	if err != nil || rev == LatestRev {
+		repo, local, err = s.cloneRepo(ctx, url)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	err = repo.Checkout(ctx, rev)
+	if err != nil {
+		causes := []error{err}
+		if err = repo.Fetch(ctx); err != nil {
+			s.r.log.Warn("fetch failed:", err)
+			causes = append(causes, err)
+		} else if err = repo.Checkout(ctx, rev); err != nil {
+			causes = append(causes, err)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", "", err
+			}
+			e := NewError(ref, causes...)
+			if e.Kind != KindNetwork && e.Kind != KindAuth {
+				// The revision is missing from the cached clone, and can't be
+				// fetched from the remote either
+				e.Kind = KindRevisionNotFound
+			}
+			return "", "", e
+		}
+	}
+	return "", local, nil
+}
+
+func (s *repoSource) openRepo(ctx context.Context, url string) (Repo, string, string, error) {
+	parts := strings.Split(url, "/")
+	for i := len(parts); i > 0; i-- {
+		dir := s.r.CacheFile("repos", filepath.Join(parts[:i]...))
+		// Sometimes go-git gives false positives, check for .git directory before PlainOpen()
+		if info, err := os.Stat(filepath.Join(dir, s.marker)); err != nil || !info.IsDir() {
+			continue
+		}
+		repoURL := path.Join(parts[:i]...)
+		repo, err := s.backend.Open(ctx, repoURL, dir)
+		if err == nil {
+			s.r.log.Debug("Use cached repository:", dir)
+			return repo, dir, filepath.Join(dir, filepath.Join(parts[i:]...)), nil
+		}
+	}
+	return nil, "", "", errors.New("failed to open " + url)
+}
+
+func (s *repoSource) cloneRepo(ctx context.Context, url string) (Repo, string, error) {
+	for _, vcsPath := range []string{
+		`^(github\.com/[A-Za-z0-9_.\-]+/[A-Za-z0-9_.\-]+)((/[\p{L}0-9_.\-]+)*)$`,
+		`^(bitbucket\.org/[A-Za-z0-9_.\-]+/[A-Za-z0-9_.\-]+)((/[A-Za-z0-9_.\-]+)*)$`,
+	} {
+		re := regexp.MustCompile(vcsPath)
+		if m := re.FindStringSubmatch(url); m != nil {
+			if repo, dir, err := s.tryCloneRepo(ctx, m[1]); err == nil {
+				return repo, filepath.Join(dir, m[2]), nil
+			} else if ctx.Err() != nil {
+				return nil, "", err
+			} else {
+				return nil, "", NewError(url, err)
+			}
+		}
+	}
+	// Every prefix of the URL may be a repository, the causes of all the
+	// failed attempts are reported
+	attempts := []error{}
+	parts := strings.Split(url, "/")
+	for i := 1; i <= len(parts); i++ {
+		repoURL := path.Join(parts[:i]...)
+		repo, dir, err := s.tryCloneRepo(ctx, repoURL)
+		if err == nil {
+			return repo, filepath.Join(dir, filepath.Join(parts[i:]...)), nil
+		} else if ctx.Err() != nil {
+			return nil, "", err
+		}
+		attempts = append(attempts, err)
+	}
+	return nil, "", NewError(url, attempts...)
+}
+
+// tryCloneRepo clones the repository into a temporary directory next to its
+// cache directory, and renames it when the clone is complete. An interrupted
+// clone is removed, and is never mistaken for a cached repository.
+func (s *repoSource) tryCloneRepo(ctx context.Context, repoURL string) (Repo, string, error) {
+	dir := s.r.CacheFile("repos", repoURL)
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return nil, "", err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), filepath.Base(dir)+".clone-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(tmp)
+	s.r.log.Info("Trying to clone", repoURL, "into", dir)
+	if _, err := s.backend.Clone(ctx, repoURL, tmp); err != nil {
+		return nil, "", fmt.Errorf("clone %s: %w", repoURL, err)
+	}
+	// Directories of nested repositories may have been created already
+	os.Remove(dir)
+	if err := os.Rename(tmp, dir); err != nil {
+		return nil, "", err
+	}
+	repo, err := s.backend.Open(ctx, repoURL, dir)
+	if err != nil {
+		return nil, "", err
+	}
+	s.r.log.Info("Cloned repository:", dir, repoURL)
+	return repo, dir, nil
+}
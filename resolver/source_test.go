@@ -0,0 +1,78 @@
+package resolver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSource struct {
+	root string
+}
+
+func (s fakeSource) Resolve(ctx context.Context, ref string) (string, string, error) {
+	return s.root, filepath.Join(s.root, "foo.proto"), nil
+}
+
+func TestSourceFor(t *testing.T) {
+	r := New(WithRoute("hg.example.com", "hg"), WithRoute("github.com/org/repo", "go-git"))
+	for ref, source := range map[string]string{
+		"github.com/org/repo/foo.proto@v1": "go-git",
+		"github.com/org/repo@v1":           "go-git",
+		"github.com/org/repository/foo":    "git",
+		"hg.example.com/repo/foo.proto":    "hg",
+		"file:///tmp/foo.proto":            "local",
+		"example.com/repo/foo.proto":       "git",
+		"https://example.com/a.zip//foo":   "http",
+		"gomod://example.com/mod@v1.0.0":   "gomod",
+		"maven://com.example:api:1.0.0":    "maven",
+	} {
+		assert.Equal(t, source, r.SourceFor(ref), ref)
+	}
+	assert.Equal(t, "hg", New(WithDefaultSource("hg")).SourceFor("example.com/repo"))
+
+	assert.Equal(t, "https://hg.example.com/repo", r.CloneURL("hg.example.com/repo"))
+	assert.Equal(t, "https://example.com/repo", r.CloneURL("example.com/repo"))
+	assert.Equal(t, "", r.CloneURL("file:///tmp"))
+}
+
+// registerTestSource registers the source for the duration of the test.
+func registerTestSource(t *testing.T, name string, factory SourceFactory) {
+	RegisterSource(name, factory)
+	t.Cleanup(func() {
+		sourcesMu.Lock()
+		defer sourcesMu.Unlock()
+		delete(sources, name)
+	})
+}
+
+func TestRegisterSource(t *testing.T) {
+	registerTestSource(t, "test", func(r *Resolver) Source { return fakeSource{root: r.CacheFile("test")} })
+	assert.Contains(t, SourceNames(), "test")
+	assert.Contains(t, SourceNames(), "go-git")
+	assert.Panics(t, func() { RegisterSource("test", nil) })
+
+	r := New(WithCacheDir("/cache"), WithRoute("test://", "test"))
+	root, local, err := r.ResolveRoot(context.Background(), "test://foo")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("/cache", "test"), root)
+	assert.Equal(t, filepath.Join("/cache", "test", "foo.proto"), local)
+
+	_, err = New(WithRoute("test://", "missing")).Resolve(context.Background(), "test://foo")
+	assert.Error(t, err)
+}
+
+func TestLocalSource(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "foo.proto")
+	assert.NoError(t, os.WriteFile(file, []byte(`syntax = "proto3";`), 0644))
+	root, local, err := New().ResolveRoot(context.Background(), "file://"+filepath.ToSlash(file))
+	assert.NoError(t, err)
+	assert.Equal(t, dir, root)
+	assert.Equal(t, file, local)
+	_, err = New().Resolve(context.Background(), "file://"+filepath.ToSlash(filepath.Join(dir, "bar.proto")))
+	assert.Error(t, err)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sixt/protoc/v3/resolver"
+)
+
+// defaultSource is the source used for the references that match no route,
+// "git" for the command line git tool or "go-git" for the go-git library.
+var defaultSource = "git"
+
+// setupSources selects the default source from the PROTOC_GIT environment
+// variable, overridden by the wrapper-specific --git=git|go-git flag. The
+// flags are removed from the returned arguments.
+func setupSources(args []string) ([]string, error) {
+	if s := os.Getenv("PROTOC_GIT"); s != "" {
+		defaultSource = s
+	}
+	out := []string{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--git=") {
+			defaultSource = strings.TrimPrefix(arg, "--git=")
+		} else {
+			out = append(out, arg)
+		}
+	}
+	for _, name := range resolver.SourceNames() {
+		if name == defaultSource {
+			return out, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown source: %s, available: %s", defaultSource, strings.Join(resolver.SourceNames(), ", "))
+}
+
+// mavenRepository returns the remote repository URL from $PROTOC_MAVEN_REPO
+// or the config file, if any.
+func mavenRepository() string {
+	if url := os.Getenv("PROTOC_MAVEN_REPO"); url != "" {
+		return url
+	}
+	return cfg.MavenRepository
+}
+
+// sourceOptions returns the resolver options selecting the default source,
+// the Maven repository, and routing the references to the sources configured
+// in the "sources" section of the config.
+func sourceOptions() []resolver.Option {
+	opts := []resolver.Option{resolver.WithDefaultSource(defaultSource)}
+	if url := mavenRepository(); url != "" {
+		opts = append(opts, resolver.WithMavenRepository(url))
+	}
+	for prefix, name := range cfg.Sources {
+		opts = append(opts, resolver.WithRoute(prefix, name))
+	}
+	return opts
+}
+
+// downloadSource resolves the remote reference with the source selected by
+// the resolver routes: git repositories by default, HTTP(S) files and
+// archives, Go modules, Maven artifacts, or any other registered source.
+// Local replacements from the config take precedence over repositories.
+// Returns the include root provided by the source, or an empty string if it
+// is derived from the reference, and the local path.
+func downloadSource(ref string) (string, string, error) {
+	if !strings.Contains(ref, "://") {
+		url, rev := resolver.SplitRev(ref)
+		if local, ok := cfg.replace(url); ok {
+			if rev != "" {
+				logInfo("Using local replacement for", url, "=>", local, "ignoring revision", rev)
+			} else {
+				logInfo("Using local replacement for", url, "=>", local)
+			}
+			return "", local, nil
+		}
+	}
+	return newResolver().ResolveRoot(runCtx, ref)
+}
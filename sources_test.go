@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetupSources(t *testing.T) {
+	defer func(s string) { defaultSource = s }(defaultSource)
+	defer os.Unsetenv("PROTOC_GIT")
+
+	os.Setenv("PROTOC_GIT", "go-git")
+	args, err := setupSources([]string{"-I=.", "foo.proto"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-I=.", "foo.proto"}, args)
+	assert.Equal(t, "go-git", defaultSource)
+
+	args, err = setupSources([]string{"--git=git", "foo.proto"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo.proto"}, args)
+	assert.Equal(t, "git", defaultSource)
+
+	_, err = setupSources([]string{"--git=svn"})
+	assert.Error(t, err)
+}
+
+func TestSourceRoutes(t *testing.T) {
+	dir := t.TempDir()
+	defer func(f func() string) { cacheDir = f }(cacheDir)
+	cacheDir = func() string { return filepath.Join(dir, "cache") }
+	defer func(c *config) { cfg = c }(cfg)
+	cfg = &config{Sources: map[string]string{"hg.example.com": "hg"}}
+
+	r := newResolver()
+	assert.Equal(t, "http", r.SourceFor("https://example.com/foo.proto"))
+	assert.Equal(t, "gomod", r.SourceFor("gomod://github.com/org/mod@v1.0.0/foo.proto"))
+	assert.Equal(t, "maven", r.SourceFor("maven://com.example:api:1.0.0//foo.proto"))
+	assert.Equal(t, "hg", r.SourceFor("hg.example.com/repo/foo.proto"))
+	assert.Equal(t, "git", r.SourceFor("github.com/org/repo/foo.proto"))
+
+	// Local files are included relative to their directory
+	file := filepath.Join(dir, "api", "foo.proto")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+	assert.NoError(t, os.WriteFile(file, []byte("syntax = \"proto3\";\n"), 0644))
+	args, files, err := processArgs([]string{"file://" + filepath.ToSlash(file)})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{file}, files)
+	assert.Contains(t, args, "-I"+filepath.Dir(file))
+}